@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -14,6 +15,34 @@ var Version = "dev"
 type App struct {
 	ctx       context.Context
 	sshClient *ssh.Client
+
+	// keyPath, ip and auth are the parameters of the last successful
+	// connection, used to reconnect after a reboot. keyPath is empty for
+	// password connections, whose password auth holds in memory only.
+	keyPath string
+	ip      string
+	auth    []ssh.AuthMethod
+
+	// fetchedRevisions keeps the templates.json contents returned by
+	// FetchTemplates or written by a sync, keyed by revision, as the base for
+	// three-way merges. fetchedOrder lists the revisions oldest first.
+	fetchedRevisions   map[string][]byte
+	fetchedOrder       []string
+	fetchedRevisionsMu sync.Mutex
+
+	// stock is the set of built-in template filenames, loaded on first use
+	stock   map[string]bool
+	stockMu sync.Mutex
+
+	// rootMountMode is the mount mode of the device's root filesystem when
+	// the app connected; writableDepth counts nested withWritableRoot calls
+	rootMountMode string
+	writableDepth int
+	mountMu       sync.Mutex
+
+	// device describes the connected device, read on first use
+	device   *DeviceInfo
+	deviceMu sync.Mutex
 }
 
 // NewApp creates a new App application struct
@@ -27,6 +56,20 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 }
 
+// resetDeviceState clears everything cached about the previously connected device
+func (a *App) resetDeviceState() {
+	a.fetchedRevisionsMu.Lock()
+	a.fetchedRevisions = nil
+	a.fetchedOrder = nil
+	a.fetchedRevisionsMu.Unlock()
+	a.stockMu.Lock()
+	a.stock = nil
+	a.stockMu.Unlock()
+	a.deviceMu.Lock()
+	a.device = nil
+	a.deviceMu.Unlock()
+}
+
 // GetVersion returns the application version
 func (a *App) GetVersion() string {
 	return Version
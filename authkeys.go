@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authorizedKeysPath is the authorized_keys file of the root user the app connects as
+const authorizedKeysPath = "/home/root/.ssh/authorized_keys"
+
+// ListAuthorizedKeys returns the public keys allowed to log in to the device
+func (a *App) ListAuthorizedKeys() ([]AuthorizedKey, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	lines, err := a.readAuthorizedKeys("AuthorizedKeys")
+	if err != nil {
+		return nil, err
+	}
+	inUse := a.currentKeyFingerprint()
+
+	keys := []AuthorizedKey{}
+	for _, line := range lines {
+		key, ok := parseAuthorizedKeyLine(line)
+		if !ok {
+			continue
+		}
+		key.InUse = key.Fingerprint == inUse
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// RevokeAuthorizedKeys removes the keys with the given SHA256 fingerprints
+// from authorized_keys. The key of the current connection cannot be revoked.
+func (a *App) RevokeAuthorizedKeys(fingerprints []string) error {
+	log.Printf("[AuthorizedKeys] Revoking %d keys...", len(fingerprints))
+
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+	if inUse := a.currentKeyFingerprint(); inUse != "" {
+		for _, fingerprint := range fingerprints {
+			if fingerprint == inUse {
+				return fmt.Errorf("the key %s is used by the current connection and cannot be revoked", fingerprint)
+			}
+		}
+	}
+
+	if err := a.removeAuthorizedKeys("AuthorizedKeys", fingerprints); err != nil {
+		return err
+	}
+
+	log.Printf("[AuthorizedKeys] SUCCESS: %d keys revoked", len(fingerprints))
+	return nil
+}
+
+// RotateSSHKey replaces the key of the current connection with a newly
+// generated one: the new key is authorized, verified by connecting with it,
+// and only then is the old key removed from the device. If the new key can't
+// be verified, it is revoked and deleted again and the connection is left as
+// it was. The old key's files are kept locally. It returns the new key, which
+// the connection now uses. Like connecting, it is refused while another
+// operation is changing the device.
+func (a *App) RotateSSHKey() (SSHKey, error) {
+	log.Println("[RotateSSHKey] Rotating SSH key...")
+
+	if a.sshClient == nil {
+		return SSHKey{}, fmt.Errorf("not connected to reMarkable device")
+	}
+	if a.changingDevice() {
+		return SSHKey{}, fmt.Errorf("cannot rotate the key while another operation is changing the device")
+	}
+	oldFingerprint := a.currentKeyFingerprint()
+	if oldFingerprint == "" {
+		return SSHKey{}, fmt.Errorf("the current connection does not use an SSH key")
+	}
+
+	key, err := a.GenerateSSHKey()
+	if err != nil {
+		return SSHKey{}, err
+	}
+	auth, newFingerprint, err := a.authorizeRotatedKey(key)
+	if err != nil {
+		deleteKeyFiles(key)
+		return SSHKey{}, err
+	}
+
+	// Check the new key on a connection of its own, so the current one and
+	// the state kept for it stay untouched until the key is known to work
+	client, err := dialDevice(a.ip, auth)
+	if err != nil {
+		if revokeErr := a.removeAuthorizedKeys("RotateSSHKey", []string{newFingerprint}); revokeErr != nil {
+			log.Printf("[RotateSSHKey] ERROR: Failed to revoke the unverified key %s: %v", newFingerprint, revokeErr)
+			return SSHKey{}, fmt.Errorf("the new key %s could not be verified and could not be revoked, the old key was kept: %w", key.Name, err)
+		}
+		deleteKeyFiles(key)
+		return SSHKey{}, fmt.Errorf("the new key could not be verified and was removed again, the old key was kept: %w", err)
+	}
+
+	// The device is the same, so everything known about it stays valid
+	oldClient := a.sshClient
+	a.sshClient = client
+	a.keyPath, a.auth = key.Path, auth
+	oldClient.Close()
+
+	if err := a.removeAuthorizedKeys("RotateSSHKey", []string{oldFingerprint}); err != nil {
+		return key, fmt.Errorf("now connected with %s, but the old key could not be revoked: %w", key.Name, err)
+	}
+
+	log.Printf("[RotateSSHKey] SUCCESS: Now using %s, revoked %s", key.Name, oldFingerprint)
+	return key, nil
+}
+
+// authorizeRotatedKey adds a generated key to authorized_keys and returns
+// the authentication and fingerprint for it
+func (a *App) authorizeRotatedKey(key SSHKey) ([]ssh.AuthMethod, string, error) {
+	auth, err := keyAuth(key.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	publicKeyPath, err := expandPath(key.Path + ".pub")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to expand key path: %w", err)
+	}
+	publicKeyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read public key: %w", err)
+	}
+	parsed, ok := parseAuthorizedKeyLine(string(publicKeyData))
+	if !ok {
+		return nil, "", fmt.Errorf("failed to parse public key")
+	}
+	cmd, err := authorizeKeyCommand(publicKeyData)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := a.runCommand("RotateSSHKey", cmd); err != nil {
+		return nil, "", fmt.Errorf("failed to authorize the new key: %w", err)
+	}
+
+	return auth, parsed.Fingerprint, nil
+}
+
+// deleteKeyFiles removes the local files of a generated key that is not used
+func deleteKeyFiles(key SSHKey) {
+	privateKeyPath, err := expandPath(key.Path)
+	if err != nil {
+		return
+	}
+	for _, keyFile := range []string{privateKeyPath, privateKeyPath + ".pub"} {
+		if err := os.Remove(keyFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("[RotateSSHKey] WARNING: Failed to delete %s: %v", keyFile, err)
+		}
+	}
+}
+
+// removeAuthorizedKeys rewrites authorized_keys without the keys with the
+// given fingerprints, keeping every other line as it is
+func (a *App) removeAuthorizedKeys(op string, fingerprints []string) error {
+	lines, err := a.readAuthorizedKeys(op)
+	if err != nil {
+		return err
+	}
+
+	revoke := make(map[string]bool, len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		revoke[fingerprint] = true
+	}
+	found := make(map[string]bool, len(fingerprints))
+	var kept []byte
+	for _, line := range lines {
+		if key, ok := parseAuthorizedKeyLine(line); ok && revoke[key.Fingerprint] {
+			found[key.Fingerprint] = true
+			continue
+		}
+		kept = append(append(kept, line...), '\n')
+	}
+	for _, fingerprint := range fingerprints {
+		if !found[fingerprint] {
+			return fmt.Errorf("key %s is not authorized on the device", fingerprint)
+		}
+	}
+
+	// Write a copy and rename it so a dropped connection can't leave a partial file
+	staging := authorizedKeysPath + ".new"
+	cmd := fmt.Sprintf("cat > %s && chmod 600 %s && mv %s %s",
+		shellQuote(staging), shellQuote(staging), shellQuote(staging), shellQuote(authorizedKeysPath))
+	if err := a.runCommandWithInput(op, cmd, kept); err != nil {
+		return fmt.Errorf("failed to update authorized keys: %w", err)
+	}
+
+	return nil
+}
+
+// readAuthorizedKeys returns the lines of authorized_keys, or none if it doesn't exist
+func (a *App) readAuthorizedKeys(op string) ([]string, error) {
+	output, err := a.runCommand(op, fmt.Sprintf("[ ! -f %s ] || cat %s", shellQuote(authorizedKeysPath), shellQuote(authorizedKeysPath)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized keys: %w", err)
+	}
+
+	text := strings.TrimRight(string(output), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// currentKeyFingerprint returns the SHA256 fingerprint of the key the
+// current connection uses, or an empty string if it isn't known
+func (a *App) currentKeyFingerprint() string {
+	if a.keyPath == "" {
+		return ""
+	}
+	expandedPath, err := expandPath(a.keyPath)
+	if err != nil {
+		return ""
+	}
+	keyData, err := os.ReadFile(expandedPath)
+	if err != nil {
+		return ""
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+// parseAuthorizedKeyLine parses one line of authorized_keys, reporting false
+// for blank lines, comments and keys that can't be parsed
+func parseAuthorizedKeyLine(line string) (AuthorizedKey, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return AuthorizedKey{}, false
+	}
+	publicKey, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(trimmed))
+	if err != nil {
+		return AuthorizedKey{}, false
+	}
+
+	return AuthorizedKey{
+		Type:        publicKey.Type(),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		Comment:     comment,
+		Options:     strings.Join(options, ","),
+	}, true
+}
+
+// authorizeKeyCommand returns a remote command that appends the public key
+// to authorized_keys unless it is already there, and prints "added" or
+// "present" accordingly
+func authorizeKeyCommand(publicKeyData []byte) (string, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+	// Match on the key fields of active lines, the same key may have been
+	// added with other options or another comment
+	blob := base64.StdEncoding.EncodeToString(publicKey.Marshal())
+	present := fmt.Sprintf(`awk -v t=%s -v k=%s '!/^[[:space:]]*#/ { for (i = 2; i <= NF; i++) if ($(i-1) == t && $i == k) f = 1 } END { exit !f }'`,
+		shellQuote(publicKey.Type()), shellQuote(blob))
+	line := strings.TrimSpace(string(publicKeyData))
+	file := shellQuote(authorizedKeysPath)
+
+	return fmt.Sprintf(`mkdir -p %s && chmod 700 %s && touch %s && chmod 600 %s && if %s %s; then echo present; else { [ -z "$(tail -c 1 %s)" ] || echo >> %s; } && echo %s >> %s && echo added; fi`,
+		shellQuote(path.Dir(authorizedKeysPath)), shellQuote(path.Dir(authorizedKeysPath)), file, file,
+		present, file, file, file, shellQuote(line), file), nil
+}
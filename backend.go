@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Template formats reported in TemplateList.Format, see templateBackend
+const (
+	// TemplateFormatLegacy stores images in the templates directory, listed in templates.json
+	TemplateFormatLegacy = "templates.json"
+	// TemplateFormatUser is reported by firmware that also loads .template
+	// files with metadata from the xochitl folder, alongside templates.json
+	TemplateFormatUser = "user-template"
+)
+
+// userTemplateMinVersion is the first UI release that loads user templates
+// from the xochitl folder
+const userTemplateMinVersion = "3.18"
+
+// templateBackend lists, uploads and deletes the templates kept in the format
+// of the connected firmware. Every firmware reads templates.json, which the
+// sync pipeline handles directly; a backend adds whatever is stored beside it.
+type templateBackend interface {
+	// format is reported in TemplateList.Format
+	format() string
+	// list returns the templates kept outside templates.json
+	list(op string) ([]DeviceTemplate, error)
+	// plan adds the uploads and deletions the backend handles to the plan and
+	// returns the ones left for templates.json
+	plan(plan *SyncPlan, templates []SyncTemplate, deletions []string) ([]SyncTemplate, []string, error)
+	// apply makes the backend's part of a plan on the device
+	apply(plan *SyncPlan) error
+	// verify checks that the device matches the backend's part of a plan
+	verify(plan *SyncPlan) error
+}
+
+// templateBackend returns the backend for the connected device's firmware.
+// If the firmware can't be detected the legacy backend is used, which every
+// firmware supports.
+func (a *App) templateBackend(op string) templateBackend {
+	info, err := a.deviceInfo(op)
+	if err != nil {
+		log.Printf("[%s] WARNING: Using templates.json only, failed to detect the firmware: %v", op, err)
+		return &legacyBackend{}
+	}
+
+	if versionAtLeast(info.XochitlVersion, userTemplateMinVersion) {
+		log.Printf("[%s] Using user templates for UI version %s", op, info.XochitlVersion)
+		return &userTemplateBackend{app: a}
+	}
+	return &legacyBackend{}
+}
+
+// legacyBackend keeps templates as images listed in templates.json only
+type legacyBackend struct{}
+
+func (b *legacyBackend) format() string { return TemplateFormatLegacy }
+
+func (b *legacyBackend) list(op string) ([]DeviceTemplate, error) { return nil, nil }
+
+func (b *legacyBackend) plan(plan *SyncPlan, templates []SyncTemplate, deletions []string) ([]SyncTemplate, []string, error) {
+	for _, tmpl := range templates {
+		if isUserTemplateFile(tmpl.LocalPath) {
+			return nil, nil, fmt.Errorf("%s is a user template, which this firmware does not support", tmpl.LocalPath)
+		}
+	}
+	return templates, deletions, nil
+}
+
+func (b *legacyBackend) apply(plan *SyncPlan) error {
+	if len(plan.UserTemplates) > 0 || len(plan.UserDeletions) > 0 {
+		return fmt.Errorf("the plan changes user templates, which this firmware does not support")
+	}
+	return nil
+}
+
+func (b *legacyBackend) verify(plan *SyncPlan) error { return nil }
+
+// versionAtLeast compares dotted version numbers such as 3.18.1.2. An
+// unparseable version counts as older than any other.
+func versionAtLeast(version, min string) bool {
+	have := strings.Split(version, ".")
+	want := strings.Split(min, ".")
+	for i, w := range want {
+		wantPart, _ := strconv.Atoi(w)
+		if i >= len(have) {
+			return wantPart == 0
+		}
+		havePart, err := strconv.Atoi(have[i])
+		if err != nil {
+			return false
+		}
+		if havePart != wantPart {
+			return havePart > wantPart
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		min     string
+		want    bool
+	}{
+		{"3.18", "3.18", true},
+		{"3.18.0.1", "3.18", true},
+		{"3.19.1.2", "3.18", true},
+		{"4.0", "3.18", true},
+		{"3.17.9", "3.18", false},
+		{"3.8.2.1965", "3.18", false},
+		{"2.15", "3.18", false},
+		{"3", "3.0", true},
+		{"3", "3.18", false},
+		{"", "3.18", false},
+		{"beta", "3.18", false},
+		{"3.x", "3.18", false},
+	}
+
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("versionAtLeast(%q, %q) = %t, want %t", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// backupMetadataFile is the name of the metadata entry in local backup archives
+const backupMetadataFile = "backup.json"
+
+// SelectBackupFolder opens a native dialog to choose where backups are downloaded
+func (a *App) SelectBackupFolder() (string, error) {
+	settings, err := loadSettings()
+	if err != nil {
+		log.Printf("[Backup] WARNING: Failed to load settings: %v", err)
+	}
+
+	selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "Select Backup Folder",
+		DefaultDirectory:     settings.LocalBackupDir,
+		CanCreateDirectories: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to open folder dialog: %w", err)
+	}
+
+	return selection, nil
+}
+
+// DownloadBackup streams a compressed tar of the templates directory to a
+// local folder. The archive records the device serial, firmware version and
+// time of the backup, so it survives firmware updates that wipe the device's
+// root partition. An empty localDir uses the folder of the previous download.
+func (a *App) DownloadBackup(localDir string) (*LocalBackup, error) {
+	log.Println("[Backup] Starting local backup download...")
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	if localDir == "" {
+		settings, err := loadSettings()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load settings: %w", err)
+		}
+		if settings.LocalBackupDir == "" {
+			return nil, fmt.Errorf("no backup folder selected")
+		}
+		localDir = settings.LocalBackupDir
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup folder: %w", err)
+	}
+
+	firmware, err := a.readFirmwareVersion("Backup")
+	if err != nil {
+		return nil, err
+	}
+	metadata := BackupMetadata{
+		Serial:     a.readDeviceSerial("Backup"),
+		Firmware:   firmware,
+		CreatedAt:  time.Now(),
+		AppVersion: Version,
+	}
+
+	archivePath := filepath.Join(localDir, fmt.Sprintf("remarkable-templates_%s_%s.tar.gz",
+		unsafeFileChars.ReplaceAllString(metadata.Serial, "_"), metadata.CreatedAt.Format("20060102_150405")))
+	log.Printf("[Backup] Downloading to %s", archivePath)
+
+	// Write to a temporary file so a failed download leaves no partial archive
+	tmpFile, err := os.CreateTemp(localDir, ".download-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	files, err := a.writeBackupArchive(tmpFile, metadata)
+	if err != nil {
+		log.Printf("[Backup] ERROR: Download failed: %v", err)
+		return nil, err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), archivePath); err != nil {
+		return nil, fmt.Errorf("failed to save backup file: %w", err)
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup file: %w", err)
+	}
+
+	if err := updateSettings(func(s *appSettings) { s.LocalBackupDir = localDir }); err != nil {
+		log.Printf("[Backup] WARNING: Failed to remember backup folder: %v", err)
+	}
+
+	log.Printf("[Backup] SUCCESS: Downloaded %d files to %s", files, archivePath)
+	return &LocalBackup{
+		Path:     archivePath,
+		Size:     info.Size(),
+		Files:    files,
+		Metadata: metadata,
+	}, nil
+}
+
+// writeBackupArchive writes a gzipped tar of the device's templates directory
+// to w, starting with the metadata entry and ending with a manifest of every
+// file's size and SHA-256. It returns the number of files archived.
+func (a *App) writeBackupArchive(w io.Writer, metadata BackupMetadata) (int, error) {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal backup metadata: %w", err)
+	}
+	if err := writeTarFile(tarWriter, backupMetadataFile, metadataJSON, metadata.CreatedAt); err != nil {
+		return 0, fmt.Errorf("failed to write backup metadata: %w", err)
+	}
+
+	// Compress on the device to keep the transfer small, then copy every
+	// entry into the local archive after the metadata
+	files := make(map[string]fileDigest)
+	prefix := path.Base(templatesDir) + "/"
+	cmd := fmt.Sprintf("tar -czf - -C %s %s", shellQuote(path.Dir(templatesDir)), shellQuote(path.Base(templatesDir)))
+	err = a.streamCommand("Backup", cmd, func(r io.Reader) error {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read backup stream: %w", err)
+		}
+		tarReader := tar.NewReader(gzipReader)
+
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read backup stream: %w", err)
+			}
+
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to write backup file: %w", err)
+			}
+
+			// Hash regular files while copying them
+			hash := sha256.New()
+			n, err := io.Copy(io.MultiWriter(tarWriter, hash), tarReader)
+			if err != nil {
+				return fmt.Errorf("failed to write backup file: %w", err)
+			}
+			name := strings.TrimPrefix(header.Name, "./")
+			if header.Typeflag == tar.TypeReg && strings.HasPrefix(name, prefix) {
+				files[name[len(prefix):]] = fileDigest{Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}
+			}
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to download templates: %w", err)
+	}
+	if _, ok := files[path.Base(templatesJSONPath)]; !ok {
+		return 0, fmt.Errorf("the backup contains no templates.json")
+	}
+
+	manifestJSON, err := json.MarshalIndent(newBackupManifest(metadata, files), "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := writeTarFile(tarWriter, backupManifestFile, manifestJSON, metadata.CreatedAt); err != nil {
+		return 0, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write backup file: %w", err)
+	}
+
+	return len(files), nil
+}
+
+// writeTarFile adds a regular file with the given content to a tar archive
+func writeTarFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
@@ -2,26 +2,297 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// rebootEvent is the frontend event RebootDevice reports its progress with
+const rebootEvent = "device:reboot"
+
+// Stages reported in RebootProgress
+const (
+	RebootStarted      = "rebooting"
+	RebootWaiting      = "waiting"
+	RebootReconnecting = "reconnecting"
+	RebootOnline       = "online"
+	RebootFailed       = "failed"
+)
+
+// Reboot timeouts: how long the device may take to go down and to come back
+const (
+	rebootShutdownTimeout = 30 * time.Second
+	rebootStartupTimeout  = 3 * time.Minute
 )
 
-// RebootDevice reboots the reMarkable device
+// RebootDevice reboots the reMarkable device and waits until it is back:
+// it watches the connection drop, polls the SSH port until the device
+// answers again and reconnects with the same credentials. Progress is emitted as
+// device:reboot events carrying a RebootProgress.
 func (a *App) RebootDevice() error {
 	if a.sshClient == nil {
 		return fmt.Errorf("not connected to reMarkable device")
 	}
+	keyPath, ip, auth := a.keyPath, a.ip, a.auth
 
+	a.emitRebootProgress(RebootStarted, "Rebooting…")
 	session, err := a.sshClient.NewSession()
 	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
+		return a.rebootFailed(fmt.Errorf("failed to create SSH session: %w", err))
+	}
+	// Reboot command may return an error because it disconnects immediately
+	// This is expected behavior
+	start := time.Now()
+	a.recordCommand("Reboot", "reboot", start, 0, 0, session.Run("reboot"))
+	session.Close()
+
+	// Wait for the device to drop the connection
+	client := a.sshClient
+	deadline := time.Now().Add(rebootShutdownTimeout)
+	for {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return a.rebootFailed(fmt.Errorf("the device did not go down within %s", rebootShutdownTimeout))
+		}
+		time.Sleep(time.Second)
 	}
-	defer session.Close()
+	client.Close()
+	a.sshClient = nil
+	a.resetDeviceState()
+	log.Println("[Reboot] Connection dropped, waiting for the device to come back...")
 
-	// Run reboot command (this will disconnect the session)
-	if err := session.Run("reboot"); err != nil {
-		// Reboot command may return an error because it disconnects immediately
-		// This is expected behavior
-		return nil
+	// Poll SSH until the device answers and accepts the connection again
+	a.emitRebootProgress(RebootWaiting, "Waiting for the device to come back…")
+	address := net.JoinHostPort(ip, "22")
+	deadline = time.Now().Add(rebootStartupTimeout)
+	for {
+		if conn, err := net.DialTimeout("tcp", address, 2*time.Second); err == nil {
+			conn.Close()
+			a.emitRebootProgress(RebootReconnecting, "Reconnecting…")
+			err := a.connect("Reboot", ip, auth, keyPath)
+			if err == nil {
+				break
+			}
+			log.Printf("[Reboot] Reconnect attempt failed: %v", err)
+		}
+		if time.Now().After(deadline) {
+			return a.rebootFailed(fmt.Errorf("the device did not come back within %s", rebootStartupTimeout))
+		}
+		time.Sleep(2 * time.Second)
 	}
 
+	log.Println("[Reboot] SUCCESS: Device is back online")
+	a.emitRebootProgress(RebootOnline, "Back online")
 	return nil
 }
+
+// emitRebootProgress reports a reboot stage to the frontend
+func (a *App) emitRebootProgress(stage, message string) {
+	log.Printf("[Reboot] %s", message)
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, rebootEvent, RebootProgress{Stage: stage, Message: message})
+	}
+}
+
+// rebootFailed reports a failed reboot to the frontend and returns err
+func (a *App) rebootFailed(err error) error {
+	a.emitRebootProgress(RebootFailed, err.Error())
+	return err
+}
+
+// uiRestartTimeout is how long RestartUI waits for xochitl to come back up
+const uiRestartTimeout = 30 * time.Second
+
+// RestartUI restarts xochitl, the reMarkable interface, so it loads changed
+// templates without rebooting the device, and waits until it is running again
+func (a *App) RestartUI() error {
+	log.Println("[RestartUI] Restarting xochitl...")
+
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+
+	if _, err := a.runCommand("RestartUI", "systemctl restart xochitl"); err != nil {
+		return fmt.Errorf("failed to restart the interface: %w", err)
+	}
+
+	// is-active prints the state and fails while the service is not active
+	deadline := time.Now().Add(uiRestartTimeout)
+	for {
+		output, _ := a.runCommand("RestartUI", "systemctl is-active xochitl || true")
+		state := strings.TrimSpace(string(output))
+		if state == "active" {
+			log.Println("[RestartUI] SUCCESS: xochitl is running")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the interface did not come back within %s (state: %s)", uiRestartTimeout, state)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Device models as reported by GetDeviceInfo
+const (
+	ModelRM1      = "reMarkable 1"
+	ModelRM2      = "reMarkable 2"
+	ModelPaperPro = "reMarkable Paper Pro"
+	ModelMove     = "reMarkable Paper Pro Move"
+	ModelUnknown  = "unknown"
+)
+
+// GetDeviceInfo returns the model, firmware, serial number and screen size of
+// the connected device. The result is read once per connection.
+func (a *App) GetDeviceInfo() (*DeviceInfo, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	return a.deviceInfo("DeviceInfo")
+}
+
+// deviceInfo returns the cached device information, reading it on first use
+func (a *App) deviceInfo(op string) (*DeviceInfo, error) {
+	a.deviceMu.Lock()
+	defer a.deviceMu.Unlock()
+
+	if a.device != nil {
+		return a.device, nil
+	}
+
+	cmd := `printf '%s\n' "$(cat /etc/version 2>/dev/null)" "$(cat /sys/devices/soc0/machine 2>/dev/null)" ` +
+		`"$(cat /sys/devices/soc0/serial_number 2>/dev/null)" ` +
+		`"$(sed -n 's/^REMARKABLE_RELEASE_VERSION=//p' /usr/share/remarkable/update.conf 2>/dev/null)" ` +
+		`"$(sed -n 's/^IMG_VERSION=//p' /etc/os-release 2>/dev/null | tr -d '"')"`
+	output, err := a.runCommand(op, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device information: %w", err)
+	}
+	lines := strings.Split(string(output), "\n")
+	if len(lines) < 5 {
+		return nil, fmt.Errorf("failed to read device information: unexpected output %q", string(output))
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+
+	info := &DeviceInfo{
+		Firmware:       lines[0],
+		Machine:        lines[1],
+		Serial:         lines[2],
+		XochitlVersion: lines[3],
+	}
+	if info.Firmware == "" {
+		return nil, fmt.Errorf("failed to read firmware version: /etc/version is empty")
+	}
+	if info.Serial == "" {
+		info.Serial = "unknown"
+	}
+	if info.XochitlVersion == "" {
+		// Older releases only record the version in os-release
+		info.XochitlVersion = lines[4]
+	}
+	info.Model, info.ScreenWidth, info.ScreenHeight = deviceModel(info.Machine)
+
+	log.Printf("[%s] Device: %s (%s), firmware %s, xochitl %s", op, info.Model, info.Machine, info.Firmware, info.XochitlVersion)
+	a.device = info
+	return info, nil
+}
+
+// deviceModel maps the SoC machine name to the model and its portrait screen size
+func deviceModel(machine string) (string, int, int) {
+	switch {
+	case strings.Contains(machine, "Ferrari"):
+		return ModelPaperPro, 1620, 2160
+	case strings.Contains(machine, "Chiappa"):
+		return ModelMove, 954, 1696
+	case strings.Contains(machine, "reMarkable 2"):
+		return ModelRM2, 1404, 1872
+	case strings.Contains(machine, "reMarkable 1"), strings.Contains(machine, "reMarkable Prototype 1"):
+		return ModelRM1, 1404, 1872
+	default:
+		return ModelUnknown, 0, 0
+	}
+}
+
+// readFirmwareVersion returns the firmware build from /etc/version on the device
+func (a *App) readFirmwareVersion(op string) (string, error) {
+	info, err := a.deviceInfo(op)
+	if err != nil {
+		return "", err
+	}
+	return info.Firmware, nil
+}
+
+// readDeviceSerial returns the serial number of the device's SoC, or "unknown"
+// if the device does not expose it
+func (a *App) readDeviceSerial(op string) string {
+	info, err := a.deviceInfo(op)
+	if err != nil {
+		return "unknown"
+	}
+	return info.Serial
+}
+
+// freeSpace returns the bytes available on the filesystem holding remotePath
+func (a *App) freeSpace(op, remotePath string) (int64, error) {
+	output, err := a.runCommand(op, "df -Pk "+shellQuote(remotePath))
+	if err != nil {
+		return 0, fmt.Errorf("failed to check free space: %w", err)
+	}
+
+	// The second line holds: filesystem, size, used, available, capacity, mount point
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("failed to check free space: unexpected df output %q", string(output))
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("failed to check free space: unexpected df output %q", string(output))
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check free space: %w", err)
+	}
+
+	return availableKB * 1024, nil
+}
+
+// diskUsage returns the bytes used by a file or directory on the device
+func (a *App) diskUsage(op, remotePath string) (int64, error) {
+	output, err := a.runCommand(op, "du -sk "+shellQuote(remotePath))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s: %w", remotePath, err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("failed to get size of %s: unexpected du output %q", remotePath, string(output))
+	}
+	usedKB, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s: %w", remotePath, err)
+	}
+
+	return usedKB * 1024, nil
+}
+
+// formatBytes formats a byte count for messages shown to the user
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
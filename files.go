@@ -5,21 +5,28 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-// SelectTemplateFile opens a native file dialog to select SVG or PNG files
+// SelectTemplateFile opens a native file dialog to select SVG or PNG files,
+// and also .template files when the device supports user templates
 func (a *App) SelectTemplateFile() (*SelectedFile, error) {
+	filter := runtime.FileFilter{
+		DisplayName: "Template Files (*.svg, *.png)",
+		Pattern:     "*.svg;*.png",
+	}
+	allowed := []string{".svg", ".png"}
+	if a.sshClient != nil && a.templateBackend("SelectTemplateFile").format() == TemplateFormatUser {
+		filter = runtime.FileFilter{DisplayName: "Template Files (*.svg, *.png, *.template)", Pattern: "*.svg;*.png;*.template"}
+		allowed = append(allowed, userTemplateExt)
+	}
+
 	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select Template File",
-		Filters: []runtime.FileFilter{
-			{
-				DisplayName: "Template Files (*.svg, *.png)",
-				Pattern:     "*.svg;*.png",
-			},
-		},
+		Title:   "Select Template File",
+		Filters: []runtime.FileFilter{filter},
 	})
 
 	if err != nil {
@@ -33,14 +40,14 @@ func (a *App) SelectTemplateFile() (*SelectedFile, error) {
 
 	// Validate file extension
 	ext := strings.ToLower(filepath.Ext(selection))
-	if ext != ".svg" && ext != ".png" {
-		return nil, fmt.Errorf("invalid file type: only SVG and PNG files are allowed")
+	if !slices.Contains(allowed, ext) {
+		return nil, fmt.Errorf("invalid file type: only %s files are allowed", strings.Join(allowed, ", "))
 	}
 
 	// Validate filename (without extension) - no spaces or special characters except - and _
 	fileName := filepath.Base(selection)
 	baseName := strings.TrimSuffix(fileName, ext)
-	
+
 	// Check if filename contains only alphanumeric characters, hyphens, and underscores
 	validFilenamePattern := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 	if !validFilenamePattern.MatchString(baseName) {
@@ -53,38 +60,16 @@ func (a *App) SelectTemplateFile() (*SelectedFile, error) {
 	}, nil
 }
 
-// scpUploadFile uploads a local file to a remote directory via SSH
-func (a *App) scpUploadFile(localPath, remoteDir string) error {
+// uploadFile uploads a local file to the given path on the device
+func (a *App) uploadFile(localPath, remotePath string) error {
 	// Read local file
 	fileData, err := os.ReadFile(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to read local file: %w", err)
 	}
 
-	fileName := filepath.Base(localPath)
-	remotePath := remoteDir + fileName
-
-	// Create SSH session
-	session, err := a.sshClient.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
-	}
-	defer session.Close()
-
-	// Get stdin pipe for writing
-	stdin, err := session.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdin pipe: %w", err)
-	}
-
-	// Start writing in a goroutine
-	go func() {
-		defer stdin.Close()
-		stdin.Write(fileData)
-	}()
-
 	// Use cat to write the file
-	if err := session.Run(fmt.Sprintf("cat > %s", remotePath)); err != nil {
+	if err := a.runCommandWithInput("Upload", "cat > "+shellQuote(remotePath), fileData); err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
 
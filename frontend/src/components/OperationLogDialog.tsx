@@ -0,0 +1,100 @@
+import { useEffect, useState } from "react";
+import { Download, Loader2 } from "lucide-react";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogHeader,
+  DialogTitle,
+} from "@/components/ui/dialog";
+import { Button } from "@/components/ui/button";
+import { ScrollArea } from "@/components/ui/scroll-area";
+import { Switch } from "@/components/ui/switch";
+import { GetOperationLog, ExportOperationLog } from "wailsjs/go/main/App";
+import { main } from "wailsjs/go/models";
+
+interface OperationLogDialogProps {
+  open: boolean;
+  onClose: () => void;
+}
+
+// Number of recent commands shown, the export contains the whole log
+const LOG_LIMIT = 200;
+
+const OperationLogDialog = ({ open, onClose }: OperationLogDialogProps) => {
+  const [entries, setEntries] = useState<main.OperationLogEntry[]>([]);
+  const [failedOnly, setFailedOnly] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+  const [exportedPath, setExportedPath] = useState("");
+
+  useEffect(() => {
+    if (!open) return;
+    setIsLoading(true);
+    GetOperationLog({ operation: "", failedOnly, search: "", limit: LOG_LIMIT })
+      .then(setEntries)
+      .catch((error) => console.error("Failed to read the operation log:", error))
+      .finally(() => setIsLoading(false));
+  }, [open, failedOnly]);
+
+  const handleExport = async () => {
+    try {
+      setExportedPath(await ExportOperationLog());
+    } catch (error) {
+      console.error("Failed to export the operation log:", error);
+    }
+  };
+
+  return (
+    <Dialog open={open} onOpenChange={onClose}>
+      <DialogContent className="sm:max-w-3xl">
+        <DialogHeader>
+          <DialogTitle className="font-serif text-xl">Operation Log</DialogTitle>
+          <DialogDescription>
+            Every command run on the device. Export the log to attach it to a bug report.
+          </DialogDescription>
+        </DialogHeader>
+        <div className="flex items-center justify-between">
+          <label className="flex items-center gap-2 text-sm text-muted-foreground">
+            <Switch checked={failedOnly} onCheckedChange={setFailedOnly} />
+            Failed only
+          </label>
+          <Button variant="outline" size="sm" onClick={handleExport}>
+            <Download className="w-4 h-4 mr-2" />
+            Export
+          </Button>
+        </div>
+        <ScrollArea className="h-96 rounded-md border">
+          {isLoading ? (
+            <div className="flex justify-center py-8">
+              <Loader2 className="w-5 h-5 animate-spin text-muted-foreground" />
+            </div>
+          ) : entries.length === 0 ? (
+            <p className="py-8 text-center text-sm text-muted-foreground">No commands logged</p>
+          ) : (
+            <ul className="divide-y text-xs">
+              {entries.map((entry, i) => (
+                <li key={i} className="px-3 py-2">
+                  <div className="flex justify-between text-muted-foreground">
+                    <span>
+                      {new Date(entry.time).toLocaleString()} · {entry.operation}
+                    </span>
+                    <span className={entry.exitCode === 0 ? "" : "text-red-500"}>
+                      exit {entry.exitCode} · {entry.durationMs} ms
+                    </span>
+                  </div>
+                  <code className="block break-all font-mono">{entry.command}</code>
+                  {entry.error && <p className="text-red-500">{entry.error}</p>}
+                </li>
+              ))}
+            </ul>
+          )}
+        </ScrollArea>
+        {exportedPath && (
+          <p className="text-xs text-muted-foreground">Exported to {exportedPath}</p>
+        )}
+      </DialogContent>
+    </Dialog>
+  );
+};
+
+export default OperationLogDialog;
@@ -11,12 +11,13 @@ import {
   DialogTitle,
   DialogDescription,
 } from "@/components/ui/dialog";
+import { ConnectWithPassword } from "wailsjs/go/main/App";
 
 interface PasswordConnectionDialogProps {
   open: boolean;
   onOpenChange: (open: boolean) => void;
   onBack: () => void;
-  onConnect: (ip: string, password: string) => void;
+  onConnect: (ip: string) => void;
 }
 
 const PasswordConnectionDialog = ({
@@ -29,21 +30,32 @@ const PasswordConnectionDialog = ({
   const [password, setPassword] = useState("");
   const [showPassword, setShowPassword] = useState(false);
   const [isConnecting, setIsConnecting] = useState(false);
+  const [connectionError, setConnectionError] = useState<string | null>(null);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     if (!password.trim()) return;
     
     setIsConnecting(true);
-    // Simulate connection attempt
-    await new Promise((resolve) => setTimeout(resolve, 1500));
-    onConnect(ip, password);
-    setIsConnecting(false);
+    setConnectionError(null);
+    try {
+      // The backend keeps the password for this session, don't hold on to it here
+      await ConnectWithPassword(ip, password);
+      setPassword("");
+      setShowPassword(false);
+      onConnect(ip);
+    } catch (error) {
+      console.error("Password connection failed:", error);
+      setConnectionError(error instanceof Error ? error.message : String(error));
+    } finally {
+      setIsConnecting(false);
+    }
   };
 
   const handleBack = () => {
     setPassword("");
     setShowPassword(false);
+    setConnectionError(null);
     onBack();
   };
 
@@ -67,6 +79,13 @@ const PasswordConnectionDialog = ({
         </DialogHeader>
 
         <form onSubmit={handleSubmit} className="space-y-4 py-4">
+          {/* Connection error message */}
+          {connectionError && (
+            <div className="p-3 rounded-lg bg-destructive/10 border border-destructive/20 text-destructive text-sm">
+              {connectionError}
+            </div>
+          )}
+
           <div className="space-y-2">
             <Label htmlFor="ip" className="text-sm font-medium">
               IP Address
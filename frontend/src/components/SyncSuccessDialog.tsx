@@ -8,12 +8,14 @@ import {
   AlertDialogHeader,
   AlertDialogTitle,
 } from "@/components/ui/alert-dialog";
-import { CheckCircle, RefreshCw } from "lucide-react";
+import { useState } from "react";
+import { CheckCircle, Loader2, Monitor, RefreshCw } from "lucide-react";
 
 interface SyncSuccessDialogProps {
   open: boolean;
   templateCount: number;
   onReboot: () => void;
+  onRestartUI: () => Promise<void>;
   onClose: () => void;
 }
 
@@ -21,8 +23,21 @@ const SyncSuccessDialog = ({
   open,
   templateCount,
   onReboot,
+  onRestartUI,
   onClose,
 }: SyncSuccessDialogProps) => {
+  const [isRestarting, setIsRestarting] = useState(false);
+
+  const handleRestartUI = async (e: React.MouseEvent) => {
+    e.preventDefault();
+    setIsRestarting(true);
+    try {
+      await onRestartUI();
+    } finally {
+      setIsRestarting(false);
+    }
+  };
+
   return (
     <AlertDialog open={open} onOpenChange={(isOpen) => !isOpen && onClose()}>
       <AlertDialogContent className="max-w-sm">
@@ -34,16 +49,20 @@ const SyncSuccessDialog = ({
           <AlertDialogDescription>
             {templateCount} {templateCount === 1 ? "template has" : "templates have"} been uploaded to your device.
             <br /><br />
-            Changes will only be reflected after rebooting the device. Would you like to reboot now?
+            Changes will only be reflected after restarting the interface or rebooting the device. Would you like to restart the interface now?
           </AlertDialogDescription>
         </AlertDialogHeader>
         <AlertDialogFooter className="flex-col gap-2 sm:flex-row">
-          <AlertDialogCancel onClick={onClose}>
+          <AlertDialogCancel onClick={onClose} disabled={isRestarting}>
             Later
           </AlertDialogCancel>
-          <AlertDialogAction onClick={onReboot} className="gap-2">
+          <AlertDialogCancel onClick={onReboot} className="gap-2" disabled={isRestarting}>
             <RefreshCw className="w-4 h-4" />
             Reboot Device
+          </AlertDialogCancel>
+          <AlertDialogAction onClick={handleRestartUI} className="gap-2" disabled={isRestarting}>
+            {isRestarting ? <Loader2 className="w-4 h-4 animate-spin" /> : <Monitor className="w-4 h-4" />}
+            Restart Interface
           </AlertDialogAction>
         </AlertDialogFooter>
       </AlertDialogContent>
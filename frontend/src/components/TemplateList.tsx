@@ -17,6 +17,7 @@ export interface Template {
   iconCode: string;
   landscape?: boolean;
   categories: string[];
+  stock?: boolean;
   synced?: boolean;
   localPath?: string;
   deletionPending?: boolean;
@@ -463,10 +464,16 @@ const TemplateList = ({ templates, onAddTemplate, onBackup, onSync, onUpdateTemp
                   <Checkbox
                     checked={selectedTemplates.has(template.filename)}
                     onCheckedChange={() => handleToggleSelection(template.filename)}
+                    disabled={template.stock}
                     className="flex-shrink-0"
                   />
                   <FileText className={`w-5 h-5 flex-shrink-0 text-muted-foreground ${template.landscape ? 'rotate-90' : ''}`} />
                   <span className="text-sm flex-1">{template.name}</span>
+                  {template.stock && (
+                    <span className="text-[10px] px-1.5 py-0.5 rounded bg-muted text-muted-foreground">
+                      Built-in
+                    </span>
+                  )}
                   {template.landscape && (
                     <span className="text-[10px] px-1.5 py-0.5 rounded bg-muted text-muted-foreground">
                       Landscape
@@ -11,6 +11,7 @@ export function mapDeviceTemplatesToTemplates(deviceTemplates: main.DeviceTempla
     iconCode: t.iconCode,
     landscape: t.landscape,
     categories: t.categories,
+    stock: t.stock,
   }));
 }
 
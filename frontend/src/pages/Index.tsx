@@ -1,24 +1,38 @@
 import { useState, useEffect, useCallback } from "react";
 import { motion } from "framer-motion";
-import { ArrowRight, CheckCircle, Unplug, Loader2, Heart } from "lucide-react";
+import { ArrowRight, CheckCircle, Unplug, Loader2, Heart, RotateCcw, ScrollText } from "lucide-react";
 import { Button } from "@/components/ui/button";
 import RemarkableDevice from "@/components/RemarkableDevice";
+import ConnectionMethodDialog from "@/components/ConnectionMethodDialog";
 import SSHKeySelectionDialog from "@/components/SSHKeySelectionDialog";
+import PasswordConnectionDialog from "@/components/PasswordConnectionDialog";
 import ConnectionLostDialog from "@/components/ConnectionLostDialog";
 import SyncSuccessDialog from "@/components/SyncSuccessDialog";
 import SupportDialog from "@/components/SupportDialog";
+import OperationLogDialog from "@/components/OperationLogDialog";
+import InfoDialog from "@/components/InfoDialog";
 import TemplateList, { Template, SelectedFileInfo } from "@/components/TemplateList";
-import { FetchTemplates, DisconnectSSH, ConnectSSH, CheckConnection, BackupTemplates, SyncTemplates, RebootDevice, GetVersion } from "wailsjs/go/main/App";
+import { FetchTemplates, DisconnectSSH, Reconnect, CheckConnection, BackupTemplates, SyncTemplates, RebootDevice, RestartUI, GetVersion, CheckInstalledTemplates, ReinstallTemplates, GetDeviceInfo } from "wailsjs/go/main/App";
 import { main } from "wailsjs/go/models";
+import { EventsOn } from "wailsjs/runtime/runtime";
 import { mapDeviceTemplatesToTemplates, removeFileExtension } from "@/lib/template-utils";
 
-type DialogState = "closed" | "ssh-select";
+type DialogState = "closed" | "method-select" | "ssh-select" | "password";
 
 interface ConnectionInfo {
-  method: "ssh";
+  method: "ssh" | "password";
   ip: string;
   keyPath?: string;
   templates: Template[];
+  revision?: string;
+  model?: string;
+  format?: string;
+}
+
+// Progress of RebootDevice, emitted as device:reboot events
+interface RebootProgress {
+  stage: "rebooting" | "waiting" | "reconnecting" | "online" | "failed";
+  message: string;
 }
 
 const Index = () => {
@@ -30,15 +44,23 @@ const Index = () => {
   const [syncSuccessDialog, setSyncSuccessDialog] = useState<{ open: boolean; count: number }>({ open: false, count: 0 });
   const [version, setVersion] = useState<string>("");
   const [supportDialogOpen, setSupportDialogOpen] = useState(false);
+  const [operationLogOpen, setOperationLogOpen] = useState(false);
+  const [rebootProgress, setRebootProgress] = useState<RebootProgress | null>(null);
+  const [missingTemplates, setMissingTemplates] = useState<main.InstalledTemplatesStatus | null>(null);
 
   // Fetch version on mount
   useEffect(() => {
     GetVersion().then(setVersion).catch(() => setVersion("dev"));
   }, []);
 
-  // Periodic connection check
+  // Follow reboot progress reported by the backend
   useEffect(() => {
-    if (!connection) return;
+    return EventsOn("device:reboot", (progress: RebootProgress) => setRebootProgress(progress));
+  }, []);
+
+  // Periodic connection check, paused while the device reboots
+  useEffect(() => {
+    if (!connection || rebootProgress) return;
 
     const checkConnectionHealth = async () => {
       try {
@@ -52,18 +74,20 @@ const Index = () => {
     checkConnectionHealth();
     const interval = setInterval(checkConnectionHealth, 10000);
     return () => clearInterval(interval);
-  }, [connection]);
+  }, [connection, rebootProgress]);
 
   const handleRetryConnection = useCallback(async () => {
-    if (!connection || !connection.keyPath) return;
+    if (!connection) return;
     
     setIsRetrying(true);
     try {
-      await ConnectSSH(connection.keyPath, connection.ip);
-      const templates = await FetchTemplates();
+      // The backend reconnects with the key or password of this session
+      await Reconnect();
+      const result = await FetchTemplates();
       setConnection({
         ...connection,
-        templates: mapDeviceTemplatesToTemplates(templates),
+        templates: mapDeviceTemplatesToTemplates(result.templates),
+        revision: result.revision,
       });
       setConnectionLost(false);
     } catch (error) {
@@ -84,23 +108,63 @@ const Index = () => {
     setConnection(null);
   }, []);
 
-  const loadTemplatesFromDevice = async (method: "ssh", ip: string, keyPath?: string) => {
+  const loadTemplatesFromDevice = async (method: "ssh" | "password", ip: string, keyPath?: string) => {
     setIsLoadingTemplates(true);
+    const model = await GetDeviceInfo()
+      .then((info) => info.model)
+      .catch(() => undefined);
     try {
-      const templates = await FetchTemplates();
+      const result = await FetchTemplates();
       setConnection({
         method,
         ip,
         keyPath,
-        templates: mapDeviceTemplatesToTemplates(templates),
+        templates: mapDeviceTemplatesToTemplates(result.templates),
+        revision: result.revision,
+        model,
+        format: result.format,
       });
     } catch (error) {
       console.error("Failed to fetch templates:", error);
       // Set connection with empty templates on error
-      setConnection({ method, ip, keyPath, templates: [] });
+      setConnection({ method, ip, keyPath, templates: [], model });
     } finally {
       setIsLoadingTemplates(false);
     }
+
+    // Offer to reinstall custom templates removed by a firmware update
+    try {
+      const status = await CheckInstalledTemplates();
+      if (status.missing.length > 0) {
+        setMissingTemplates(status);
+      }
+    } catch (error) {
+      console.error("Failed to check installed templates:", error);
+    }
+  };
+
+  const handleReinstall = async () => {
+    setMissingTemplates(null);
+    if (!connection) return;
+    try {
+      const result = await ReinstallTemplates({
+        revision: "",
+        merge: false,
+        allowStockChanges: false,
+        order: [],
+        snapshot: true,
+        restartUI: false,
+      });
+      const templates = await FetchTemplates();
+      setConnection({
+        ...connection,
+        templates: mapDeviceTemplatesToTemplates(templates.templates),
+        revision: result.revision,
+      });
+      setSyncSuccessDialog({ open: true, count: (result.plan?.uploads.length ?? 0) + (result.plan?.userTemplates?.length ?? 0) });
+    } catch (error) {
+      console.error("Reinstall failed:", error);
+    }
   };
 
   const handleSSHConnect = async (keyPath: string, ip: string) => {
@@ -109,6 +173,11 @@ const Index = () => {
     await loadTemplatesFromDevice("ssh", ip, keyPath);
   };
 
+  const handlePasswordConnect = async (ip: string) => {
+    setDialogState("closed");
+    await loadTemplatesFromDevice("password", ip);
+  };
+
   const handleDisconnect = async () => {
     try {
       await DisconnectSSH();
@@ -173,12 +242,32 @@ const Index = () => {
     // Prepare deletion data
     const deletionData: string[] = deletionPendingTemplates.map(t => t.filename);
     
-    // Call backend to sync (including deletions)
-    await SyncTemplates(syncData, deletionData);
+    // Call backend to sync (including deletions), merging with any changes
+    // made on the device since the templates were loaded
+    const result = await SyncTemplates(syncData, deletionData, {
+      revision: connection.revision ?? "",
+      merge: true,
+      allowStockChanges: false,
+      order: [],
+      snapshot: true,
+      restartUI: false,
+    });
     
+    // User templates get their IDs on the device, so reload them
+    if (result.plan?.userTemplates?.length) {
+      const reloaded = await FetchTemplates();
+      setConnection({
+        ...connection,
+        templates: mapDeviceTemplatesToTemplates(reloaded.templates),
+        revision: reloaded.revision,
+      });
+      return;
+    }
+
     // Mark templates as synced and remove deletion pending, or remove deleted templates
     setConnection({
       ...connection,
+      revision: result.revision,
       templates: connection.templates
         .filter(t => !(t.deletionPending === true && deletedFilenames.has(t.filename)))
         .map(t =>
@@ -216,23 +305,38 @@ const Index = () => {
   };
 
   const handleReboot = async () => {
+    if (!connection) return;
+    setSyncSuccessDialog({ open: false, count: 0 });
     try {
+      // Waits until the device is back and reconnected
       await RebootDevice();
-      // Reboot will disconnect, so disconnect and return to main screen
-      await DisconnectSSH();
-      setConnection(null);
-      setSyncSuccessDialog({ open: false, count: 0 });
+      const result = await FetchTemplates();
+      setConnection({
+        ...connection,
+        templates: mapDeviceTemplatesToTemplates(result.templates),
+        revision: result.revision,
+      });
+      setRebootProgress(null);
     } catch (error) {
       console.error("Reboot failed:", error);
-      // Even if reboot fails, disconnect and return to main screen
+      // The device did not come back, disconnect and return to main screen
       try {
         await DisconnectSSH();
       } catch (disconnectError) {
         console.error("Disconnect failed:", disconnectError);
       }
       setConnection(null);
-      setSyncSuccessDialog({ open: false, count: 0 });
+      setRebootProgress(null);
+    }
+  };
+
+  const handleRestartUI = async () => {
+    try {
+      await RestartUI();
+    } catch (error) {
+      console.error("Restarting the interface failed:", error);
     }
+    setSyncSuccessDialog({ open: false, count: 0 });
   };
 
   const handleConnectionLost = () => {
@@ -261,6 +365,13 @@ const Index = () => {
             <Heart className="w-3 h-3 group-hover:text-red-500 transition-colors" />
             <span>Support</span>
           </button>
+          <button
+            onClick={() => setOperationLogOpen(true)}
+            className="text-xs text-muted-foreground hover:text-foreground transition-colors flex items-center gap-1"
+          >
+            <ScrollText className="w-3 h-3" />
+            <span>Log</span>
+          </button>
         </div>
         {isConnected && (
           <motion.div
@@ -294,7 +405,7 @@ const Index = () => {
                 <CheckCircle className="w-5 h-5" />
               </div>
               <h2 className="text-2xl font-serif font-medium text-foreground tracking-tight">
-                reMarkable connected
+                {connection.model && connection.model !== "unknown" ? connection.model : "reMarkable"} connected
               </h2>
               <p className="text-muted-foreground text-base leading-relaxed">
                 Connected via SSH to{" "}
@@ -379,7 +490,7 @@ const Index = () => {
               transition={{ duration: 0.5, delay: 0.5 }}
               className="w-full flex justify-center"
             >
-              <Button variant="connect" size="lg" onClick={() => setDialogState("ssh-select")}>
+              <Button variant="connect" size="lg" onClick={() => setDialogState("method-select")}>
                 Connect Device
               </Button>
             </motion.div>
@@ -387,14 +498,29 @@ const Index = () => {
         </main>
       )}
 
+      {/* Connection Method Dialog */}
+      <ConnectionMethodDialog
+        open={dialogState === "method-select"}
+        onOpenChange={(open) => setDialogState(open ? "method-select" : "closed")}
+        onSelectMethod={(method) => setDialogState(method === "ssh" ? "ssh-select" : "password")}
+      />
+
       {/* SSH Key Selection Dialog */}
       <SSHKeySelectionDialog
         open={dialogState === "ssh-select"}
         onOpenChange={(open) => setDialogState(open ? "ssh-select" : "closed")}
-        onBack={() => setDialogState("closed")}
+        onBack={() => setDialogState("method-select")}
         onConnect={handleSSHConnect}
       />
 
+      {/* Password Connection Dialog */}
+      <PasswordConnectionDialog
+        open={dialogState === "password"}
+        onOpenChange={(open) => setDialogState(open ? "password" : "closed")}
+        onBack={() => setDialogState("method-select")}
+        onConnect={handlePasswordConnect}
+      />
+
       {/* Connection Lost Dialog */}
       <ConnectionLostDialog
         open={connectionLost}
@@ -408,13 +534,55 @@ const Index = () => {
         open={syncSuccessDialog.open}
         templateCount={syncSuccessDialog.count}
         onReboot={handleReboot}
+        onRestartUI={handleRestartUI}
         onClose={() => setSyncSuccessDialog({ open: false, count: 0 })}
       />
 
+      {/* Reboot Progress */}
+      {rebootProgress && (
+        <div className="fixed inset-0 z-50 flex items-center justify-center bg-background/80">
+          <div className="flex flex-col items-center gap-3 text-muted-foreground">
+            {rebootProgress.stage === "online" ? (
+              <CheckCircle className="w-8 h-8 text-primary" />
+            ) : (
+              <Loader2 className="w-8 h-8 animate-spin" />
+            )}
+            <span className="text-sm">{rebootProgress.message}</span>
+          </div>
+        </div>
+      )}
+
+      {/* Reinstall Dialog */}
+      <InfoDialog
+        open={missingTemplates !== null}
+        title="Custom templates missing"
+        message={
+          <>
+            {missingTemplates?.firmwareChanged
+              ? `The device was updated to ${missingTemplates.firmware}, which removed `
+              : "The device is missing "}
+            {missingTemplates?.missing.length} of your custom{" "}
+            {missingTemplates?.missing.length === 1 ? "template" : "templates"}. Would you like to reinstall{" "}
+            {missingTemplates?.missing.length === 1 ? "it" : "them"}?
+          </>
+        }
+        icon={RotateCcw}
+        onClose={() => setMissingTemplates(null)}
+        onConfirm={handleReinstall}
+        confirmLabel="Reinstall"
+        cancelLabel="Not now"
+        showCancel
+      />
+
       <SupportDialog
         open={supportDialogOpen}
         onClose={() => setSupportDialogOpen(false)}
       />
+
+      <OperationLogDialog
+        open={operationLogOpen}
+        onClose={() => setOperationLogOpen(false)}
+      />
     </div>
   );
 };
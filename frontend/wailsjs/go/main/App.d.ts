@@ -2,28 +2,108 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function ApplySyncPlan(arg1:main.SyncPlan,arg2:main.SyncOptions):Promise<main.SyncResult>;
+
 export function BackupTemplates():Promise<string>;
 
+export function CaptureScreen():Promise<main.Screenshot>;
+
 export function CheckConnection():Promise<void>;
 
+export function CheckInstalledTemplates():Promise<main.InstalledTemplatesStatus>;
+
 export function ConnectSSH(arg1:string,arg2:string):Promise<void>;
 
+export function ConnectWithPassword(arg1:string,arg2:string):Promise<void>;
+
+export function DiffBackup(arg1:string):Promise<main.SyncPlan>;
+
 export function DisconnectSSH():Promise<void>;
 
-export function FetchTemplates():Promise<Array<main.DeviceTemplate>>;
+export function DownloadBackup(arg1:string):Promise<main.LocalBackup>;
+
+export function ExportOperationLog():Promise<string>;
+
+export function FetchTemplates():Promise<main.TemplateList>;
 
 export function GenerateSSHKey():Promise<main.SSHKey>;
 
+export function GetBackupRetention():Promise<main.BackupRetention>;
+
+export function GetDeviceInfo():Promise<main.DeviceInfo>;
+
+export function GetDeviceStatus():Promise<main.DeviceStatus>;
+
+export function GetOperationLog(arg1:main.OperationLogQuery):Promise<Array<main.OperationLogEntry>>;
+
 export function GetVersion():Promise<string>;
 
+export function InstallPersistence():Promise<main.PersistenceStatus>;
+
 export function IsConnected():Promise<boolean>;
 
+export function ListAuthorizedKeys():Promise<Array<main.AuthorizedKey>>;
+
+export function ListBackups():Promise<Array<main.BackupInfo>>;
+
 export function ListSSHKeys():Promise<Array<main.SSHKey>>;
 
+export function ListSplashScreens():Promise<Array<main.SplashScreen>>;
+
+export function ListSyncHistory():Promise<Array<main.SyncSnapshot>>;
+
+export function MoveTemplate(arg1:string,arg2:number,arg3:main.SyncOptions):Promise<main.SyncResult>;
+
+export function PinTemplates(arg1:Array<string>,arg2:main.SyncOptions):Promise<main.SyncResult>;
+
+export function PlanReinstallTemplates():Promise<main.SyncPlan>;
+
+export function PlanReplaceTemplate(arg1:string,arg2:string):Promise<main.SyncPlan>;
+
+export function PlanSync(arg1:Array<main.SyncTemplate>,arg2:Array<string>,arg3:main.SyncOptions):Promise<main.SyncPlan>;
+
+export function PruneBackups():Promise<Array<string>>;
+
 export function RebootDevice():Promise<void>;
 
+export function Reconnect():Promise<void>;
+
+export function ReinstallTemplates(arg1:main.SyncOptions):Promise<main.SyncResult>;
+
+export function ReplaceSplashScreen(arg1:string,arg2:string):Promise<main.SyncResult>;
+
+export function ReplaceTemplateImage(arg1:string,arg2:string,arg3:boolean):Promise<main.SyncResult>;
+
+export function RestartUI():Promise<void>;
+
+export function RestoreBackup(arg1:string,arg2:Array<string>,arg3:boolean):Promise<main.SyncResult>;
+
+export function RestoreSplashScreen(arg1:string):Promise<void>;
+
+export function RevokeAuthorizedKeys(arg1:Array<string>):Promise<void>;
+
+export function RotateSSHKey():Promise<main.SSHKey>;
+
+export function SaveScreenshot():Promise<string>;
+
+export function SelectBackupFolder():Promise<string>;
+
+export function SelectSplashFile():Promise<main.SelectedFile>;
+
 export function SelectTemplateFile():Promise<main.SelectedFile>;
 
-export function SyncTemplates(arg1:Array<main.SyncTemplate>,arg2:Array<string>):Promise<void>;
+export function SetBackupRetention(arg1:main.BackupRetention):Promise<void>;
+
+export function SortTemplates(arg1:string,arg2:main.SyncOptions):Promise<main.SyncResult>;
+
+export function SyncTemplates(arg1:Array<main.SyncTemplate>,arg2:Array<string>,arg3:main.SyncOptions):Promise<main.SyncResult>;
+
+export function UndoSync(arg1:string):Promise<main.SyncResult>;
+
+export function UninstallPersistence():Promise<void>;
 
 export function UploadSSHKey(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function VerifyBackup(arg1:string):Promise<main.BackupVerification>;
+
+export function VerifyPersistence():Promise<main.PersistenceStatus>;
@@ -2,22 +2,50 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ApplySyncPlan(arg1, arg2) {
+  return window['go']['main']['App']['ApplySyncPlan'](arg1, arg2);
+}
+
 export function BackupTemplates() {
   return window['go']['main']['App']['BackupTemplates']();
 }
 
+export function CaptureScreen() {
+  return window['go']['main']['App']['CaptureScreen']();
+}
+
 export function CheckConnection() {
   return window['go']['main']['App']['CheckConnection']();
 }
 
+export function CheckInstalledTemplates() {
+  return window['go']['main']['App']['CheckInstalledTemplates']();
+}
+
 export function ConnectSSH(arg1, arg2) {
   return window['go']['main']['App']['ConnectSSH'](arg1, arg2);
 }
 
+export function ConnectWithPassword(arg1, arg2) {
+  return window['go']['main']['App']['ConnectWithPassword'](arg1, arg2);
+}
+
+export function DiffBackup(arg1) {
+  return window['go']['main']['App']['DiffBackup'](arg1);
+}
+
 export function DisconnectSSH() {
   return window['go']['main']['App']['DisconnectSSH']();
 }
 
+export function DownloadBackup(arg1) {
+  return window['go']['main']['App']['DownloadBackup'](arg1);
+}
+
+export function ExportOperationLog() {
+  return window['go']['main']['App']['ExportOperationLog']();
+}
+
 export function FetchTemplates() {
   return window['go']['main']['App']['FetchTemplates']();
 }
@@ -26,30 +54,162 @@ export function GenerateSSHKey() {
   return window['go']['main']['App']['GenerateSSHKey']();
 }
 
+export function GetBackupRetention() {
+  return window['go']['main']['App']['GetBackupRetention']();
+}
+
+export function GetDeviceInfo() {
+  return window['go']['main']['App']['GetDeviceInfo']();
+}
+
+export function GetDeviceStatus() {
+  return window['go']['main']['App']['GetDeviceStatus']();
+}
+
+export function GetOperationLog(arg1) {
+  return window['go']['main']['App']['GetOperationLog'](arg1);
+}
+
 export function GetVersion() {
   return window['go']['main']['App']['GetVersion']();
 }
 
+export function InstallPersistence() {
+  return window['go']['main']['App']['InstallPersistence']();
+}
+
 export function IsConnected() {
   return window['go']['main']['App']['IsConnected']();
 }
 
+export function ListAuthorizedKeys() {
+  return window['go']['main']['App']['ListAuthorizedKeys']();
+}
+
+export function ListBackups() {
+  return window['go']['main']['App']['ListBackups']();
+}
+
 export function ListSSHKeys() {
   return window['go']['main']['App']['ListSSHKeys']();
 }
 
+export function ListSplashScreens() {
+  return window['go']['main']['App']['ListSplashScreens']();
+}
+
+export function ListSyncHistory() {
+  return window['go']['main']['App']['ListSyncHistory']();
+}
+
+export function MoveTemplate(arg1, arg2, arg3) {
+  return window['go']['main']['App']['MoveTemplate'](arg1, arg2, arg3);
+}
+
+export function PinTemplates(arg1, arg2) {
+  return window['go']['main']['App']['PinTemplates'](arg1, arg2);
+}
+
+export function PlanReinstallTemplates() {
+  return window['go']['main']['App']['PlanReinstallTemplates']();
+}
+
+export function PlanReplaceTemplate(arg1, arg2) {
+  return window['go']['main']['App']['PlanReplaceTemplate'](arg1, arg2);
+}
+
+export function PlanSync(arg1, arg2, arg3) {
+  return window['go']['main']['App']['PlanSync'](arg1, arg2, arg3);
+}
+
+export function PruneBackups() {
+  return window['go']['main']['App']['PruneBackups']();
+}
+
 export function RebootDevice() {
   return window['go']['main']['App']['RebootDevice']();
 }
 
+export function Reconnect() {
+  return window['go']['main']['App']['Reconnect']();
+}
+
+export function ReinstallTemplates(arg1) {
+  return window['go']['main']['App']['ReinstallTemplates'](arg1);
+}
+
+export function ReplaceSplashScreen(arg1, arg2) {
+  return window['go']['main']['App']['ReplaceSplashScreen'](arg1, arg2);
+}
+
+export function ReplaceTemplateImage(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ReplaceTemplateImage'](arg1, arg2, arg3);
+}
+
+export function RestartUI() {
+  return window['go']['main']['App']['RestartUI']();
+}
+
+export function RestoreBackup(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RestoreBackup'](arg1, arg2, arg3);
+}
+
+export function RestoreSplashScreen(arg1) {
+  return window['go']['main']['App']['RestoreSplashScreen'](arg1);
+}
+
+export function RevokeAuthorizedKeys(arg1) {
+  return window['go']['main']['App']['RevokeAuthorizedKeys'](arg1);
+}
+
+export function RotateSSHKey() {
+  return window['go']['main']['App']['RotateSSHKey']();
+}
+
+export function SaveScreenshot() {
+  return window['go']['main']['App']['SaveScreenshot']();
+}
+
+export function SelectBackupFolder() {
+  return window['go']['main']['App']['SelectBackupFolder']();
+}
+
+export function SelectSplashFile() {
+  return window['go']['main']['App']['SelectSplashFile']();
+}
+
 export function SelectTemplateFile() {
   return window['go']['main']['App']['SelectTemplateFile']();
 }
 
-export function SyncTemplates(arg1, arg2) {
-  return window['go']['main']['App']['SyncTemplates'](arg1, arg2);
+export function SetBackupRetention(arg1) {
+  return window['go']['main']['App']['SetBackupRetention'](arg1);
+}
+
+export function SortTemplates(arg1, arg2) {
+  return window['go']['main']['App']['SortTemplates'](arg1, arg2);
+}
+
+export function SyncTemplates(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SyncTemplates'](arg1, arg2, arg3);
+}
+
+export function UndoSync(arg1) {
+  return window['go']['main']['App']['UndoSync'](arg1);
+}
+
+export function UninstallPersistence() {
+  return window['go']['main']['App']['UninstallPersistence']();
 }
 
 export function UploadSSHKey(arg1, arg2, arg3) {
   return window['go']['main']['App']['UploadSSHKey'](arg1, arg2, arg3);
 }
+
+export function VerifyBackup(arg1) {
+  return window['go']['main']['App']['VerifyBackup'](arg1);
+}
+
+export function VerifyPersistence() {
+  return window['go']['main']['App']['VerifyPersistence']();
+}
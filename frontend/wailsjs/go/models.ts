@@ -1,11 +1,233 @@
 export namespace main {
 	
+	export class AuthorizedKey {
+	    type: string;
+	    fingerprint: string;
+	    comment: string;
+	    options: string;
+	    inUse: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new AuthorizedKey(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.fingerprint = source["fingerprint"];
+	        this.comment = source["comment"];
+	        this.options = source["options"];
+	        this.inUse = source["inUse"];
+	    }
+	}
+	export class BackupMetadata {
+	    serial: string;
+	    firmware: string;
+	    // Go type: time
+	    createdAt: any;
+	    appVersion: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupMetadata(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.serial = source["serial"];
+	        this.firmware = source["firmware"];
+	        this.createdAt = this.convertValues(source["createdAt"], null);
+	        this.appVersion = source["appVersion"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BackupInfo {
+	    id: string;
+	    location: string;
+	    path: string;
+	    // Go type: time
+	    createdAt: any;
+	    size: number;
+	    templates: number;
+	    metadata?: BackupMetadata;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.location = source["location"];
+	        this.path = source["path"];
+	        this.createdAt = this.convertValues(source["createdAt"], null);
+	        this.size = source["size"];
+	        this.templates = source["templates"];
+	        this.metadata = this.convertValues(source["metadata"], BackupMetadata);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class BackupRetention {
+	    keepLast: number;
+	    keepMonthly: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupRetention(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.keepLast = source["keepLast"];
+	        this.keepMonthly = source["keepMonthly"];
+	    }
+	}
+	export class BackupVerification {
+	    id: string;
+	    ok: boolean;
+	    verified: number;
+	    missing: string[];
+	    corrupted: string[];
+	    unexpected: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupVerification(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.ok = source["ok"];
+	        this.verified = source["verified"];
+	        this.missing = source["missing"];
+	        this.corrupted = source["corrupted"];
+	        this.unexpected = source["unexpected"];
+	    }
+	}
+	export class DeviceInfo {
+	    model: string;
+	    machine: string;
+	    firmware: string;
+	    xochitlVersion: string;
+	    serial: string;
+	    screenWidth: number;
+	    screenHeight: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DeviceInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.model = source["model"];
+	        this.machine = source["machine"];
+	        this.firmware = source["firmware"];
+	        this.xochitlVersion = source["xochitlVersion"];
+	        this.serial = source["serial"];
+	        this.screenWidth = source["screenWidth"];
+	        this.screenHeight = source["screenHeight"];
+	    }
+	}
+	export class DiskUsage {
+	    total: number;
+	    used: number;
+	    free: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DiskUsage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.total = source["total"];
+	        this.used = source["used"];
+	        this.free = source["free"];
+	    }
+	}
+	export class DeviceStatus {
+	    batteryLevel: number;
+	    batteryStatus: string;
+	    charging: boolean;
+	    root: DiskUsage;
+	    home: DiskUsage;
+	    uptime: number;
+	    connection: string;
+	    mountMode: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DeviceStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.batteryLevel = source["batteryLevel"];
+	        this.batteryStatus = source["batteryStatus"];
+	        this.charging = source["charging"];
+	        this.root = this.convertValues(source["root"], DiskUsage);
+	        this.home = this.convertValues(source["home"], DiskUsage);
+	        this.uptime = source["uptime"];
+	        this.connection = source["connection"];
+	        this.mountMode = source["mountMode"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class DeviceTemplate {
 	    name: string;
 	    filename: string;
 	    iconCode: string;
 	    landscape?: boolean;
 	    categories: string[];
+	    stock?: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new DeviceTemplate(source);
@@ -18,6 +240,193 @@ export namespace main {
 	        this.iconCode = source["iconCode"];
 	        this.landscape = source["landscape"];
 	        this.categories = source["categories"];
+	        this.stock = source["stock"];
+	    }
+	}
+	
+	export class InstalledTemplatesStatus {
+	    firmware: string;
+	    recordedFirmware: string;
+	    firmwareChanged: boolean;
+	    installed: number;
+	    missing: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new InstalledTemplatesStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.firmware = source["firmware"];
+	        this.recordedFirmware = source["recordedFirmware"];
+	        this.firmwareChanged = source["firmwareChanged"];
+	        this.installed = source["installed"];
+	        this.missing = source["missing"];
+	    }
+	}
+	export class LocalBackup {
+	    path: string;
+	    size: number;
+	    files: number;
+	    metadata: BackupMetadata;
+	
+	    static createFrom(source: any = {}) {
+	        return new LocalBackup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.size = source["size"];
+	        this.files = source["files"];
+	        this.metadata = this.convertValues(source["metadata"], BackupMetadata);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class OperationLogEntry {
+	    // Go type: time
+	    time: any;
+	    operation: string;
+	    command: string;
+	    exitCode: number;
+	    durationMs: number;
+	    bytesSent: number;
+	    bytesRecv: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationLogEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.operation = source["operation"];
+	        this.command = source["command"];
+	        this.exitCode = source["exitCode"];
+	        this.durationMs = source["durationMs"];
+	        this.bytesSent = source["bytesSent"];
+	        this.bytesRecv = source["bytesRecv"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class OperationLogQuery {
+	    operation: string;
+	    failedOnly: boolean;
+	    search: string;
+	    limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationLogQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.failedOnly = source["failedOnly"];
+	        this.search = source["search"];
+	        this.limit = source["limit"];
+	    }
+	}
+	export class PersistenceStatus {
+	    ok: boolean;
+	    scriptInstalled: boolean;
+	    scriptCurrent: boolean;
+	    unitInstalled: boolean;
+	    unitCurrent: boolean;
+	    enabled: boolean;
+	    templates: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PersistenceStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ok = source["ok"];
+	        this.scriptInstalled = source["scriptInstalled"];
+	        this.scriptCurrent = source["scriptCurrent"];
+	        this.unitInstalled = source["unitInstalled"];
+	        this.unitCurrent = source["unitCurrent"];
+	        this.enabled = source["enabled"];
+	        this.templates = source["templates"];
+	    }
+	}
+	export class PlannedUpload {
+	    filename: string;
+	    localPath: string;
+	    remotePath: string;
+	    size: number;
+	    sha256: string;
+	    overwrite: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlannedUpload(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.filename = source["filename"];
+	        this.localPath = source["localPath"];
+	        this.remotePath = source["remotePath"];
+	        this.size = source["size"];
+	        this.sha256 = source["sha256"];
+	        this.overwrite = source["overwrite"];
+	    }
+	}
+	export class PlannedUserTemplate {
+	    id: string;
+	    name: string;
+	    localPath: string;
+	    size: number;
+	    sha256: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlannedUserTemplate(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.localPath = source["localPath"];
+	        this.size = source["size"];
+	        this.sha256 = source["sha256"];
 	    }
 	}
 	export class SSHKey {
@@ -34,6 +443,22 @@ export namespace main {
 	        this.path = source["path"];
 	    }
 	}
+	export class Screenshot {
+	    width: number;
+	    height: number;
+	    png: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Screenshot(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.width = source["width"];
+	        this.height = source["height"];
+	        this.png = source["png"];
+	    }
+	}
 	export class SelectedFile {
 	    name: string;
 	    path: string;
@@ -48,6 +473,225 @@ export namespace main {
 	        this.path = source["path"];
 	    }
 	}
+	export class SplashScreen {
+	    name: string;
+	    size: number;
+	    width: number;
+	    height: number;
+	    customized: boolean;
+	    image: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SplashScreen(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.size = source["size"];
+	        this.width = source["width"];
+	        this.height = source["height"];
+	        this.customized = source["customized"];
+	        this.image = source["image"];
+	    }
+	}
+	export class SyncOptions {
+	    revision: string;
+	    merge: boolean;
+	    allowStockChanges: boolean;
+	    order: string[];
+	    snapshot: boolean;
+	    restartUI: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.revision = source["revision"];
+	        this.merge = source["merge"];
+	        this.allowStockChanges = source["allowStockChanges"];
+	        this.order = source["order"];
+	        this.snapshot = source["snapshot"];
+	        this.restartUI = source["restartUI"];
+	    }
+	}
+	export class TemplateChange {
+	    before: DeviceTemplate;
+	    after: DeviceTemplate;
+	
+	    static createFrom(source: any = {}) {
+	        return new TemplateChange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.before = this.convertValues(source["before"], DeviceTemplate);
+	        this.after = this.convertValues(source["after"], DeviceTemplate);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SyncPlan {
+	    revision: string;
+	    uploads: PlannedUpload[];
+	    deletions: string[];
+	    added: DeviceTemplate[];
+	    removed: DeviceTemplate[];
+	    changed: TemplateChange[];
+	    reordered: boolean;
+	    keptFiles: string[];
+	    userTemplates: PlannedUserTemplate[];
+	    userDeletions: string[];
+	    stockChanges: string[];
+	    before: string;
+	    after: string;
+	    diff: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncPlan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.revision = source["revision"];
+	        this.uploads = this.convertValues(source["uploads"], PlannedUpload);
+	        this.deletions = source["deletions"];
+	        this.added = this.convertValues(source["added"], DeviceTemplate);
+	        this.removed = this.convertValues(source["removed"], DeviceTemplate);
+	        this.changed = this.convertValues(source["changed"], TemplateChange);
+	        this.reordered = source["reordered"];
+	        this.keptFiles = source["keptFiles"];
+	        this.userTemplates = this.convertValues(source["userTemplates"], PlannedUserTemplate);
+	        this.userDeletions = source["userDeletions"];
+	        this.stockChanges = source["stockChanges"];
+	        this.before = source["before"];
+	        this.after = source["after"];
+	        this.diff = source["diff"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SyncResult {
+	    status: string;
+	    revision: string;
+	    error?: string;
+	    rollbackError?: string;
+	    backup?: string;
+	    snapshot?: string;
+	    plan?: SyncPlan;
+	    restartError?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.status = source["status"];
+	        this.revision = source["revision"];
+	        this.error = source["error"];
+	        this.rollbackError = source["rollbackError"];
+	        this.backup = source["backup"];
+	        this.snapshot = source["snapshot"];
+	        this.plan = this.convertValues(source["plan"], SyncPlan);
+	        this.restartError = source["restartError"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SyncSnapshot {
+	    id: string;
+	    // Go type: time
+	    createdAt: any;
+	    serial: string;
+	    revision: string;
+	    summary: string;
+	    files: string[];
+	    created: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncSnapshot(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.createdAt = this.convertValues(source["createdAt"], null);
+	        this.serial = source["serial"];
+	        this.revision = source["revision"];
+	        this.summary = source["summary"];
+	        this.files = source["files"];
+	        this.created = source["created"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class SyncTemplate {
 	    name: string;
 	    filename: string;
@@ -64,6 +708,41 @@ export namespace main {
 	        this.localPath = source["localPath"];
 	    }
 	}
+	
+	export class TemplateList {
+	    templates: DeviceTemplate[];
+	    revision: string;
+	    format: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TemplateList(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.templates = this.convertValues(source["templates"], DeviceTemplate);
+	        this.revision = source["revision"];
+	        this.format = source["format"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 
 }
 
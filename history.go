@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSyncSnapshots is the number of pre-sync snapshots kept in the local history
+const maxSyncSnapshots = 20
+
+// syncSnapshotFile is the name of the snapshot description in each history folder
+const syncSnapshotFile = "snapshot.json"
+
+// ListSyncHistory returns the pre-sync snapshots that can be undone, newest first
+func (a *App) ListSyncHistory() ([]SyncSnapshot, error) {
+	dir, err := appDataDir("history")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync history: %w", err)
+	}
+
+	snapshots := []SyncSnapshot{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var snapshot SyncSnapshot
+		if err := readJSONFile(filepath.Join(dir, entry.Name(), syncSnapshotFile), &snapshot); err != nil {
+			log.Printf("[SyncHistory] WARNING: Skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+// UndoSync restores the device to the state saved before the sync with the
+// given snapshot ID: templates.json and every overwritten or deleted file are
+// restored, and files the sync added are removed. It refuses if templates.json
+// changed after that sync, since undoing it would lose the newer changes.
+func (a *App) UndoSync(id string) (*SyncResult, error) {
+	log.Printf("[UndoSync] Undoing sync %s...", id)
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	dir, err := appDataDir("history")
+	if err != nil {
+		return nil, err
+	}
+	if id == "" || id != filepath.Base(id) {
+		return nil, fmt.Errorf("invalid snapshot ID %q", id)
+	}
+	snapshotDir := filepath.Join(dir, id)
+
+	var snapshot SyncSnapshot
+	if err := readJSONFile(filepath.Join(snapshotDir, syncSnapshotFile), &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+
+	if serial := a.readDeviceSerial("UndoSync"); serial != snapshot.Serial {
+		return nil, fmt.Errorf("snapshot %s was taken on a different device", id)
+	}
+	current, _, err := a.readTemplatesJSON("UndoSync")
+	if err != nil {
+		return nil, err
+	}
+	if templatesRevision(current) != snapshot.Revision {
+		return nil, fmt.Errorf("templates.json was changed on the device after this sync, it can no longer be undone")
+	}
+
+	// Load the saved files before touching the device
+	originals := make([][]byte, len(snapshot.Files))
+	for i := range snapshot.Files {
+		originals[i], err = os.ReadFile(filepath.Join(snapshotDir, "files", strconv.Itoa(i)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+		}
+	}
+
+	txn := a.beginTransaction("UndoSync")
+	for _, remotePath := range append(append([]string{}, snapshot.Files...), snapshot.Created...) {
+		if err := txn.snapshot(remotePath); err != nil {
+			return nil, err
+		}
+	}
+
+	var result *SyncResult
+	err = a.withWritableRoot("UndoSync", func() error {
+		var err error
+		result, err = txn.finish(nil, a.restoreSyncSnapshot(snapshot, originals))
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for i, remotePath := range snapshot.Files {
+		if remotePath == templatesJSONPath {
+			result.Revision = a.rememberRevision(originals[i])
+		}
+	}
+
+	if err := os.RemoveAll(snapshotDir); err != nil {
+		log.Printf("[UndoSync] WARNING: Failed to remove snapshot %s: %v", id, err)
+	}
+
+	return result, nil
+}
+
+// restoreSyncSnapshot writes back the saved files and removes the files the sync created
+func (a *App) restoreSyncSnapshot(snapshot SyncSnapshot, originals [][]byte) error {
+	for i, remotePath := range snapshot.Files {
+		if err := a.runCommandWithInput("UndoSync", "cat > "+shellQuote(remotePath), originals[i]); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", remotePath, err)
+		}
+	}
+
+	if len(snapshot.Created) > 0 {
+		quoted := make([]string, len(snapshot.Created))
+		for i, remotePath := range snapshot.Created {
+			quoted[i] = shellQuote(remotePath)
+		}
+		if _, err := a.runCommand("UndoSync", "rm -f "+strings.Join(quoted, " ")); err != nil {
+			return fmt.Errorf("failed to remove files added by the sync: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// saveSyncSnapshot stores the files a transaction snapshotted in the local
+// sync history, so the sync described by plan can be undone later
+func (a *App) saveSyncSnapshot(txn *remoteTransaction, plan *SyncPlan) (*SyncSnapshot, error) {
+	dir, err := appDataDir("history")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot := &SyncSnapshot{
+		ID:        now.Format("20060102_150405.000000"),
+		CreatedAt: now,
+		Serial:    a.readDeviceSerial("ApplySyncPlan"),
+		Revision:  templatesRevision([]byte(plan.After)),
+		Summary: fmt.Sprintf("%d added, %d removed, %d changed, %d file(s) uploaded, %d file(s) deleted",
+			len(plan.Added), len(plan.Removed), len(plan.Changed), len(plan.Uploads), len(plan.Deletions)),
+		Files:   []string{},
+		Created: []string{},
+	}
+
+	snapshotDir := filepath.Join(dir, snapshot.ID)
+	if err := os.MkdirAll(filepath.Join(snapshotDir, "files"), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot folder: %w", err)
+	}
+
+	for _, remotePath := range txn.paths {
+		if txn.created[remotePath] {
+			snapshot.Created = append(snapshot.Created, remotePath)
+			continue
+		}
+		name := strconv.Itoa(len(snapshot.Files))
+		if err := os.WriteFile(filepath.Join(snapshotDir, "files", name), txn.originals[remotePath], 0600); err != nil {
+			os.RemoveAll(snapshotDir)
+			return nil, fmt.Errorf("failed to save snapshot: %w", err)
+		}
+		snapshot.Files = append(snapshot.Files, remotePath)
+	}
+
+	if err := writeJSONFile(filepath.Join(snapshotDir, syncSnapshotFile), snapshot); err != nil {
+		os.RemoveAll(snapshotDir)
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	pruneSyncHistory(dir)
+	return snapshot, nil
+}
+
+// discardSyncSnapshot removes a snapshot whose sync was not committed
+func discardSyncSnapshot(id string) {
+	dir, err := appDataDir("history")
+	if err != nil {
+		return
+	}
+	os.RemoveAll(filepath.Join(dir, id))
+}
+
+// pruneSyncHistory removes the oldest snapshots beyond maxSyncSnapshots.
+// Snapshot IDs are timestamps, so they sort oldest first.
+func pruneSyncHistory(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+
+	for len(ids) > maxSyncSnapshots {
+		if err := os.RemoveAll(filepath.Join(dir, ids[0])); err != nil {
+			log.Printf("[SyncHistory] WARNING: Failed to remove snapshot %s: %v", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// installedRecordFile is the name of the record in each device's installed folder
+const installedRecordFile = "installed.json"
+
+// installedRecord is the local record of the custom templates the app
+// installed on one device, kept so they can be reinstalled after a firmware
+// update replaces the templates directory. Copies of the images are stored
+// in the record's files folder.
+type installedRecord struct {
+	Serial    string              `json:"serial"`
+	Firmware  string              `json:"firmware"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+	Templates []InstalledTemplate `json:"templates"`
+}
+
+// CheckInstalledTemplates compares the custom templates the app installed on
+// the connected device with what is on it now. Templates go missing when a
+// firmware update replaces the templates directory.
+func (a *App) CheckInstalledTemplates() (*InstalledTemplatesStatus, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	dir, record, err := a.loadInstalledRecord("CheckInstalled")
+	if err != nil {
+		return nil, err
+	}
+
+	firmware, err := a.readFirmwareVersion("CheckInstalled")
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := a.missingInstalledTemplates("CheckInstalled", dir, record)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &InstalledTemplatesStatus{
+		Firmware:         firmware,
+		RecordedFirmware: record.Firmware,
+		FirmwareChanged:  record.Firmware != "" && record.Firmware != firmware,
+		Installed:        len(record.Templates),
+		Missing:          []string{},
+	}
+	for _, tmpl := range missing {
+		status.Missing = append(status.Missing, tmpl.Entry.Filename)
+	}
+
+	log.Printf("[CheckInstalled] %d custom templates recorded, %d missing (firmware %s, recorded %s)",
+		status.Installed, len(status.Missing), firmware, record.Firmware)
+	return status, nil
+}
+
+// ReinstallTemplates uploads the images and templates.json entries, or the
+// user template files, of the recorded custom templates that are missing
+// from the device
+func (a *App) ReinstallTemplates(options SyncOptions) (*SyncResult, error) {
+	log.Println("[Reinstall] Reinstalling missing custom templates...")
+
+	plan, err := a.PlanReinstallTemplates()
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Uploads) == 0 && len(plan.UserTemplates) == 0 && plan.After == plan.Before {
+		return nil, fmt.Errorf("no custom templates are missing from the device")
+	}
+
+	return a.ApplySyncPlan(plan, options)
+}
+
+// PlanReinstallTemplates computes the plan for reinstalling the recorded
+// custom templates that are missing from the device
+func (a *App) PlanReinstallTemplates() (*SyncPlan, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	dir, record, err := a.loadInstalledRecord("Reinstall")
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := a.missingInstalledTemplates("Reinstall", dir, record)
+	if err != nil {
+		return nil, err
+	}
+
+	before, data, err := a.readTemplatesJSON("Reinstall")
+	if err != nil {
+		return nil, err
+	}
+	existingFiles, err := a.listTemplateFiles("Reinstall")
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{
+		Revision:      templatesRevision(before),
+		Uploads:       []PlannedUpload{},
+		Deletions:     []string{},
+		Added:         []DeviceTemplate{},
+		Removed:       []DeviceTemplate{},
+		Changed:       []TemplateChange{},
+		KeptFiles:     []string{},
+		UserTemplates: []PlannedUserTemplate{},
+		UserDeletions: []string{},
+		Before:        string(before),
+	}
+
+	entries := data.Templates
+	for _, tmpl := range missing {
+		if isUserTemplateRecord(tmpl) {
+			// User templates are added back under the ID they had
+			localPath := filepath.Join(dir, "files", tmpl.Files[0])
+			digest, err := localFileDigest(localPath)
+			if err != nil {
+				return nil, fmt.Errorf("the saved copy of %s is missing: %w", tmpl.Files[0], err)
+			}
+			plan.UserTemplates = append(plan.UserTemplates, PlannedUserTemplate{
+				ID:        tmpl.Entry.Filename,
+				Name:      tmpl.Entry.Name,
+				LocalPath: localPath,
+				Size:      digest.Size,
+				SHA256:    digest.SHA256,
+			})
+			plan.Added = append(plan.Added, tmpl.Entry)
+			continue
+		}
+
+		for _, fileName := range tmpl.Files {
+			if existingFiles[fileName] {
+				continue
+			}
+			localPath := filepath.Join(dir, "files", fileName)
+			digest, err := localFileDigest(localPath)
+			if err != nil {
+				return nil, fmt.Errorf("the saved copy of %s is missing: %w", fileName, err)
+			}
+			plan.Uploads = append(plan.Uploads, PlannedUpload{
+				Filename:   tmpl.Entry.Filename,
+				LocalPath:  localPath,
+				RemotePath: path.Join(templatesDir, fileName),
+				Size:       digest.Size,
+				SHA256:     digest.SHA256,
+			})
+		}
+
+		if indexOfTemplate(entries, tmpl.Entry.Filename) < 0 {
+			entry := tmpl.Entry
+			entry.Stock = false
+			plan.Added = append(plan.Added, entry)
+			entries = append(entries, entry)
+		}
+	}
+
+	plan.After, err = updatedTemplatesJSON(before, data, entries)
+	if err != nil {
+		return nil, err
+	}
+	plan.Diff = templatesJSONDiff(plan.Before, plan.After)
+
+	plan.StockChanges = a.stockChanges("Reinstall", plan)
+
+	return plan, nil
+}
+
+// missingInstalledTemplates returns the recorded templates whose entry or
+// image files are no longer on the device
+func (a *App) missingInstalledTemplates(op, dir string, record *installedRecord) ([]InstalledTemplate, error) {
+	if len(record.Templates) == 0 {
+		return nil, nil
+	}
+
+	_, data, err := a.readTemplatesJSON(op)
+	if err != nil {
+		return nil, err
+	}
+	existingFiles, err := a.listTemplateFiles(op)
+	if err != nil {
+		return nil, err
+	}
+	backend := a.templateBackend(op)
+	supported := backend.format() == TemplateFormatUser
+	userTemplates, err := backend.list(op)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []InstalledTemplate
+	for _, tmpl := range record.Templates {
+		if isUserTemplateRecord(tmpl) {
+			// Without user template support they can't be reinstalled
+			if supported && indexOfTemplate(userTemplates, tmpl.Entry.Filename) < 0 {
+				missing = append(missing, tmpl)
+			}
+			continue
+		}
+
+		gone := indexOfTemplate(data.Templates, tmpl.Entry.Filename) < 0
+		for _, fileName := range tmpl.Files {
+			if !existingFiles[fileName] {
+				gone = true
+			}
+		}
+		if gone {
+			missing = append(missing, tmpl)
+		}
+	}
+
+	return missing, nil
+}
+
+// recordInstalledTemplates updates the local record after a committed plan:
+// uploaded custom templates and user templates are added with a copy of
+// their files, removed templates and deleted images are dropped
+func (a *App) recordInstalledTemplates(op string, plan *SyncPlan) error {
+	dir, record, err := a.loadInstalledRecord(op)
+	if err != nil {
+		return err
+	}
+	firmware, err := a.readFirmwareVersion(op)
+	if err != nil {
+		return err
+	}
+	stock := a.stockTemplates(op)
+
+	var after templatesJSON
+	if err := json.Unmarshal([]byte(plan.After), &after); err != nil {
+		return fmt.Errorf("failed to parse templates.json: %w", err)
+	}
+
+	// Keep only templates that still exist, with up to date entries
+	deleted := make(map[string]bool)
+	for _, remotePath := range plan.Deletions {
+		deleted[path.Base(remotePath)] = true
+	}
+	templates := []InstalledTemplate{}
+	for _, tmpl := range record.Templates {
+		if isUserTemplateRecord(tmpl) {
+			if slices.Contains(plan.UserDeletions, tmpl.Entry.Filename) {
+				os.Remove(filepath.Join(dir, "files", tmpl.Files[0]))
+				continue
+			}
+			templates = append(templates, tmpl)
+			continue
+		}
+
+		i := indexOfTemplate(after.Templates, tmpl.Entry.Filename)
+		if i < 0 {
+			for _, fileName := range tmpl.Files {
+				os.Remove(filepath.Join(dir, "files", fileName))
+			}
+			continue
+		}
+		tmpl.Entry = after.Templates[i]
+		files := []string{}
+		for _, fileName := range tmpl.Files {
+			if deleted[fileName] {
+				os.Remove(filepath.Join(dir, "files", fileName))
+				continue
+			}
+			files = append(files, fileName)
+		}
+		tmpl.Files = files
+		templates = append(templates, tmpl)
+	}
+
+	// Add the uploaded images of custom templates
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0700); err != nil {
+		return fmt.Errorf("failed to create installed templates folder: %w", err)
+	}
+	for _, upload := range plan.Uploads {
+		i := indexOfTemplate(after.Templates, upload.Filename)
+		if i < 0 || stock[upload.Filename] {
+			continue
+		}
+
+		fileName := path.Base(upload.RemotePath)
+		if err := copyLocalFile(upload.LocalPath, filepath.Join(dir, "files", fileName)); err != nil {
+			return fmt.Errorf("failed to save a copy of %s: %w", fileName, err)
+		}
+
+		j := indexOfInstalledTemplate(templates, upload.Filename)
+		if j < 0 {
+			templates = append(templates, InstalledTemplate{Entry: after.Templates[i], Files: []string{}})
+			j = len(templates) - 1
+		}
+		if !slices.Contains(templates[j].Files, fileName) {
+			templates[j].Files = append(templates[j].Files, fileName)
+		}
+	}
+
+	for _, tmpl := range plan.UserTemplates {
+		fileName := tmpl.ID + userTemplateExt
+		if err := copyLocalFile(tmpl.LocalPath, filepath.Join(dir, "files", fileName)); err != nil {
+			return fmt.Errorf("failed to save a copy of %s: %w", fileName, err)
+		}
+		entry := DeviceTemplate{Name: tmpl.Name, Filename: tmpl.ID, Categories: []string{}}
+		if i := indexOfTemplate(plan.Added, tmpl.ID); i >= 0 {
+			entry = plan.Added[i]
+		}
+		if j := indexOfInstalledTemplate(templates, tmpl.ID); j >= 0 {
+			templates[j] = InstalledTemplate{Entry: entry, Files: []string{fileName}}
+		} else {
+			templates = append(templates, InstalledTemplate{Entry: entry, Files: []string{fileName}})
+		}
+	}
+
+	record.Firmware = firmware
+	record.UpdatedAt = time.Now()
+	record.Templates = templates
+	if err := writeJSONFile(filepath.Join(dir, installedRecordFile), record); err != nil {
+		return fmt.Errorf("failed to save installed templates: %w", err)
+	}
+
+	log.Printf("[%s] Recorded %d installed custom templates", op, len(templates))
+	return nil
+}
+
+// loadInstalledRecord returns the folder and record of the connected device.
+// A device without a record gets an empty one.
+func (a *App) loadInstalledRecord(op string) (string, *installedRecord, error) {
+	serial := a.readDeviceSerial(op)
+	dir, err := appDataDir("installed", unsafeFileChars.ReplaceAllString(serial, "_"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &installedRecord{Serial: serial, Templates: []InstalledTemplate{}}
+	if _, err := os.Stat(filepath.Join(dir, installedRecordFile)); err == nil {
+		if err := readJSONFile(filepath.Join(dir, installedRecordFile), record); err != nil {
+			return "", nil, fmt.Errorf("failed to read installed templates: %w", err)
+		}
+	}
+
+	return dir, record, nil
+}
+
+// isUserTemplateRecord reports whether a recorded template is a user template
+func isUserTemplateRecord(tmpl InstalledTemplate) bool {
+	return len(tmpl.Files) == 1 && path.Ext(tmpl.Files[0]) == userTemplateExt
+}
+
+// indexOfInstalledTemplate returns the index of the recorded template with the given filename, or -1
+func indexOfInstalledTemplate(templates []InstalledTemplate, filename string) int {
+	for i, tmpl := range templates {
+		if tmpl.Entry.Filename == filename {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyLocalFile copies a local file, doing nothing when source and destination are the same
+func copyLocalFile(src, dst string) error {
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupManifestFile is the name of the integrity manifest stored with each backup
+const backupManifestFile = "manifest.json"
+
+// VerifyBackup re-hashes the files of a backup on the device or in a local
+// archive and compares them with the backup's manifest
+func (a *App) VerifyBackup(id string) (*BackupVerification, error) {
+	log.Printf("[VerifyBackup] Verifying backup %s...", id)
+
+	manifest, files, err := a.loadBackupForVerification(id)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := verifyManifest(manifest, files)
+	verification.ID = id
+	log.Printf("[VerifyBackup] %d verified, %d missing, %d corrupted, %d unexpected",
+		verification.Verified, len(verification.Missing), len(verification.Corrupted), len(verification.Unexpected))
+
+	return verification, nil
+}
+
+// loadBackupForVerification reads the manifest of a backup and hashes its files
+func (a *App) loadBackupForVerification(id string) (*BackupManifest, map[string]fileDigest, error) {
+	location, name, _ := strings.Cut(id, ":")
+
+	var manifestData []byte
+	var files map[string]fileDigest
+	switch location {
+	case BackupOnDevice:
+		if a.sshClient == nil {
+			return nil, nil, fmt.Errorf("not connected to reMarkable device")
+		}
+		if name != path.Base(name) || !strings.HasPrefix(name, "backup_") {
+			return nil, nil, fmt.Errorf("invalid device backup %q", name)
+		}
+		dir := path.Join(backupRootDir, name)
+
+		var err error
+		manifestData, err = a.runCommand("VerifyBackup", "cat "+shellQuote(path.Join(dir, backupManifestFile)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("the backup has no readable manifest: %w", err)
+		}
+		files, err = a.remoteFileDigests("VerifyBackup", dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		delete(files, backupManifestFile)
+
+	case BackupLocal:
+		archivePath, err := localBackupPath(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		archive, err := readBackupArchive(archivePath, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if archive.manifest == nil {
+			return nil, nil, fmt.Errorf("the backup has no manifest")
+		}
+		manifestData = archive.manifest
+		files = archive.files
+
+	default:
+		return nil, nil, fmt.Errorf("invalid backup ID %q", id)
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the backup manifest: %w", err)
+	}
+
+	return &manifest, files, nil
+}
+
+// verifyManifest compares the files found in a backup with its manifest
+func verifyManifest(manifest *BackupManifest, files map[string]fileDigest) *BackupVerification {
+	verification := &BackupVerification{
+		Missing:    []string{},
+		Corrupted:  []string{},
+		Unexpected: []string{},
+	}
+
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, file := range manifest.Files {
+		listed[file.Name] = true
+
+		digest, ok := files[file.Name]
+		switch {
+		case !ok:
+			verification.Missing = append(verification.Missing, file.Name)
+		case digest.Size != file.Size || digest.SHA256 != file.SHA256:
+			verification.Corrupted = append(verification.Corrupted, file.Name)
+		default:
+			verification.Verified++
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			verification.Unexpected = append(verification.Unexpected, name)
+		}
+	}
+	sort.Strings(verification.Unexpected)
+
+	verification.OK = len(verification.Missing) == 0 && len(verification.Corrupted) == 0
+	return verification
+}
+
+// newBackupManifest builds the manifest for a set of file digests
+func newBackupManifest(metadata BackupMetadata, files map[string]fileDigest) *BackupManifest {
+	manifest := &BackupManifest{
+		CreatedAt: metadata.CreatedAt,
+		Firmware:  metadata.Firmware,
+		Serial:    metadata.Serial,
+		Files:     []ManifestFile{},
+	}
+
+	for name, digest := range files {
+		manifest.Files = append(manifest.Files, ManifestFile{Name: name, Size: digest.Size, SHA256: digest.SHA256})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Name < manifest.Files[j].Name
+	})
+
+	return manifest
+}
+
+// writeDeviceBackupManifest stores the manifest of a backup folder on the
+// device, listing the given digests of the files it was copied from
+func (a *App) writeDeviceBackupManifest(backupDir string, files map[string]fileDigest) error {
+	firmware, err := a.readFirmwareVersion("Backup")
+	if err != nil {
+		return err
+	}
+	metadata := BackupMetadata{
+		Serial:     a.readDeviceSerial("Backup"),
+		Firmware:   firmware,
+		CreatedAt:  time.Now(),
+		AppVersion: Version,
+	}
+
+	if _, ok := files[path.Base(templatesJSONPath)]; !ok {
+		return fmt.Errorf("the backup contains no templates.json")
+	}
+
+	manifestJSON, err := json.MarshalIndent(newBackupManifest(metadata, files), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := a.runCommandWithInput("Backup", "cat > "+shellQuote(path.Join(backupDir, backupManifestFile)), manifestJSON); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	manifest := &BackupManifest{Files: []ManifestFile{
+		{Name: "templates.json", Size: 10, SHA256: "aa"},
+		{Name: "Blank.png", Size: 20, SHA256: "bb"},
+	}}
+
+	tests := []struct {
+		name  string
+		files map[string]fileDigest
+		want  BackupVerification
+	}{
+		{
+			name: "complete",
+			files: map[string]fileDigest{
+				"templates.json": {Size: 10, SHA256: "aa"},
+				"Blank.png":      {Size: 20, SHA256: "bb"},
+			},
+			want: BackupVerification{OK: true, Verified: 2, Missing: []string{}, Corrupted: []string{}, Unexpected: []string{}},
+		},
+		{
+			name: "missing file",
+			files: map[string]fileDigest{
+				"templates.json": {Size: 10, SHA256: "aa"},
+			},
+			want: BackupVerification{Verified: 1, Missing: []string{"Blank.png"}, Corrupted: []string{}, Unexpected: []string{}},
+		},
+		{
+			name: "different hash",
+			files: map[string]fileDigest{
+				"templates.json": {Size: 10, SHA256: "aa"},
+				"Blank.png":      {Size: 20, SHA256: "cc"},
+			},
+			want: BackupVerification{Verified: 1, Missing: []string{}, Corrupted: []string{"Blank.png"}, Unexpected: []string{}},
+		},
+		{
+			name: "different size",
+			files: map[string]fileDigest{
+				"templates.json": {Size: 9, SHA256: "aa"},
+				"Blank.png":      {Size: 20, SHA256: "bb"},
+			},
+			want: BackupVerification{Verified: 1, Missing: []string{}, Corrupted: []string{"templates.json"}, Unexpected: []string{}},
+		},
+		{
+			name: "unexpected files are reported but still OK",
+			files: map[string]fileDigest{
+				"templates.json": {Size: 10, SHA256: "aa"},
+				"Blank.png":      {Size: 20, SHA256: "bb"},
+				"Lines.png":      {Size: 5, SHA256: "dd"},
+				"Dots.png":       {Size: 5, SHA256: "ee"},
+			},
+			want: BackupVerification{OK: true, Verified: 2, Missing: []string{}, Corrupted: []string{}, Unexpected: []string{"Dots.png", "Lines.png"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := verifyManifest(manifest, tt.files)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("verifyManifest() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Mount modes of the root filesystem
+const (
+	mountReadOnly  = "ro"
+	mountReadWrite = "rw"
+)
+
+// readRootMountMode returns whether the root filesystem is mounted read-only or read-write
+func (a *App) readRootMountMode(op string) (string, error) {
+	output, err := a.runCommand(op, `awk '$2 == "/" { print $4 }' /proc/mounts | tail -n 1`)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the root mount mode: %w", err)
+	}
+
+	mode, _, _ := strings.Cut(strings.TrimSpace(string(output)), ",")
+	if mode != mountReadOnly && mode != mountReadWrite {
+		return "", fmt.Errorf("failed to read the root mount mode: unexpected mount options %q", string(output))
+	}
+
+	return mode, nil
+}
+
+// withWritableRoot runs fn with the root filesystem mounted read-write. If
+// the device was read-only when the app connected, it is remounted read-only
+// afterwards. Calls may nest; only the outermost call remounts.
+func (a *App) withWritableRoot(op string, fn func() error) error {
+	a.mountMu.Lock()
+	remount := a.rootMountMode == mountReadOnly && a.writableDepth == 0
+	if remount {
+		log.Printf("[%s] Remounting root filesystem as read-write...", op)
+		if _, err := a.runCommand(op, "mount -o remount,rw /"); err != nil {
+			a.mountMu.Unlock()
+			return fmt.Errorf("failed to remount the root filesystem read-write: %w", err)
+		}
+	}
+	a.writableDepth++
+	a.mountMu.Unlock()
+
+	err := fn()
+
+	a.mountMu.Lock()
+	defer a.mountMu.Unlock()
+	a.writableDepth--
+	if remount {
+		log.Printf("[%s] Remounting root filesystem as read-only...", op)
+		if _, remountErr := a.runCommand(op, "mount -o remount,ro /"); remountErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to remount the root filesystem read-only: %w", remountErr))
+		}
+	}
+
+	return err
+}
+
+// changingDevice reports whether an operation has the root filesystem
+// remounted, so the connection it runs on must not be replaced
+func (a *App) changingDevice() bool {
+	a.mountMu.Lock()
+	defer a.mountMu.Unlock()
+	return a.writableDepth > 0
+}
+
+// restoreRootMountMode remounts the root filesystem read-only if it was
+// read-only when the app connected but is read-write now
+func (a *App) restoreRootMountMode(op string) error {
+	a.mountMu.Lock()
+	defer a.mountMu.Unlock()
+
+	if a.rootMountMode != mountReadOnly {
+		return nil
+	}
+	mode, err := a.readRootMountMode(op)
+	if err != nil {
+		return err
+	}
+	if mode == mountReadOnly {
+		return nil
+	}
+
+	log.Printf("[%s] Remounting root filesystem as read-only...", op)
+	if _, err := a.runCommand(op, "mount -o remount,ro /"); err != nil {
+		return fmt.Errorf("failed to remount the root filesystem read-only: %w", err)
+	}
+	return nil
+}
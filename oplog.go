@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"golang.org/x/crypto/ssh"
+)
+
+// The operation log is written as JSON lines to operations.jsonl in the
+// logs folder. When it grows past maxOperationLogSize it is renamed to
+// operations.1.jsonl, shifting older files up to maxOperationLogFiles.
+const (
+	operationLogName     = "operations"
+	maxOperationLogSize  = 1 << 20
+	maxOperationLogFiles = 3
+)
+
+// operationLogMu serializes writes and rotation of the operation log
+var operationLogMu sync.Mutex
+
+// recordCommand appends a remote command to the operation log. Failing to
+// write the log never fails the command itself.
+func (a *App) recordCommand(op, cmd string, start time.Time, sent, received int64, err error) {
+	entry := OperationLogEntry{
+		Time:       start,
+		Operation:  op,
+		Command:    cmd,
+		ExitCode:   commandExitCode(err),
+		DurationMs: time.Since(start).Milliseconds(),
+		BytesSent:  sent,
+		BytesRecv:  received,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := appendOperationLog(entry); err != nil {
+		log.Printf("[OperationLog] WARNING: Failed to write operation log: %v", err)
+	}
+}
+
+// commandExitCode returns the exit status of a remote command, or -1 if it
+// did not exit normally, for example because the connection dropped
+func commandExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// GetOperationLog returns the logged remote commands matching the query, newest first
+func (a *App) GetOperationLog(query OperationLogQuery) ([]OperationLogEntry, error) {
+	entries, err := readOperationLog()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []OperationLogEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if query.Operation != "" && entry.Operation != query.Operation {
+			continue
+		}
+		if query.FailedOnly && entry.ExitCode == 0 {
+			continue
+		}
+		if query.Search != "" && !strings.Contains(entry.Command, query.Search) {
+			continue
+		}
+		matched = append(matched, entry)
+		if query.Limit > 0 && len(matched) >= query.Limit {
+			break
+		}
+	}
+
+	return matched, nil
+}
+
+// ExportOperationLog saves the whole operation log, oldest first, to a file
+// chosen in a native dialog, for attaching to bug reports. It returns the
+// path, or an empty string if the user cancelled.
+func (a *App) ExportOperationLog() (string, error) {
+	entries, err := readOperationLog()
+	if err != nil {
+		return "", err
+	}
+
+	selection, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Operation Log",
+		DefaultFilename: fmt.Sprintf("remarkable-template-manager_%s.jsonl", time.Now().Format("20060102_150405")),
+		Filters: []runtime.FileFilter{
+			{DisplayName: "JSON Lines (*.jsonl)", Pattern: "*.jsonl"},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to open save dialog: %w", err)
+	}
+	if selection == "" {
+		return "", nil
+	}
+
+	file, err := os.Create(selection)
+	if err != nil {
+		return "", fmt.Errorf("failed to export operation log: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return "", fmt.Errorf("failed to export operation log: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to export operation log: %w", err)
+	}
+
+	return selection, nil
+}
+
+// appendOperationLog writes an entry to the current log file, rotating it first if it is full
+func appendOperationLog(entry OperationLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	operationLogMu.Lock()
+	defer operationLogMu.Unlock()
+
+	dir, err := appDataDir("logs")
+	if err != nil {
+		return err
+	}
+	current := operationLogPath(dir, 0)
+	if info, err := os.Stat(current); err == nil && info.Size()+int64(len(line)) > maxOperationLogSize {
+		rotateOperationLog(dir)
+	}
+
+	file, err := os.OpenFile(current, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotateOperationLog shifts every log file up by one, dropping the oldest
+func rotateOperationLog(dir string) {
+	os.Remove(operationLogPath(dir, maxOperationLogFiles-1))
+	for i := maxOperationLogFiles - 2; i >= 0; i-- {
+		os.Rename(operationLogPath(dir, i), operationLogPath(dir, i+1))
+	}
+}
+
+// readOperationLog returns every logged entry, oldest first
+func readOperationLog() ([]OperationLogEntry, error) {
+	operationLogMu.Lock()
+	defer operationLogMu.Unlock()
+
+	dir, err := appDataDir("logs")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []OperationLogEntry
+	for i := maxOperationLogFiles - 1; i >= 0; i-- {
+		file, err := os.Open(operationLogPath(dir, i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation log: %w", err)
+		}
+		entries, err = appendOperationLogEntries(entries, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation log: %w", err)
+		}
+	}
+
+	// Files are read oldest first, sorting only fixes clock changes
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// appendOperationLogEntries parses the JSON lines of r, skipping lines cut off by a crash
+func appendOperationLogEntries(entries []OperationLogEntry, r io.Reader) ([]OperationLogEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxOperationLogSize)
+	for scanner.Scan() {
+		var entry OperationLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// operationLogPath returns the path of the current log file (0) or a rotated one
+func operationLogPath(dir string, index int) string {
+	if index == 0 {
+		return filepath.Join(dir, operationLogName+".jsonl")
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%d.jsonl", operationLogName, index))
+}
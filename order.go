@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sort keys accepted by SortTemplates
+const (
+	SortByName     = "name"
+	SortByCategory = "category"
+)
+
+// MoveTemplate moves a template to the given position in templates.json,
+// which is the position it has in the device's template picker
+func (a *App) MoveTemplate(filename string, index int, options SyncOptions) (*SyncResult, error) {
+	entries, err := a.currentTemplates("MoveTemplate", &options)
+	if err != nil {
+		return nil, err
+	}
+
+	from := indexOfTemplate(entries, filename)
+	if from < 0 {
+		return nil, unorderedTemplateError(filename)
+	}
+	if index < 0 || index >= len(entries) {
+		return nil, fmt.Errorf("invalid position %d for %d templates", index, len(entries))
+	}
+
+	moved := entries[from]
+	entries = append(entries[:from], entries[from+1:]...)
+	entries = append(entries[:index], append([]DeviceTemplate{moved}, entries[index:]...)...)
+
+	options.Order = templateFilenames(entries)
+	return a.SyncTemplates(nil, nil, options)
+}
+
+// SortTemplates sorts templates.json by name or by category, then name
+func (a *App) SortTemplates(by string, options SyncOptions) (*SyncResult, error) {
+	entries, err := a.currentTemplates("SortTemplates", &options)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	}
+
+	switch by {
+	case SortByName:
+		sort.SliceStable(entries, byName)
+	case SortByCategory:
+		// Templates without a category go last
+		category := func(entry DeviceTemplate) string {
+			if len(entry.Categories) == 0 {
+				return "\uffff"
+			}
+			return strings.ToLower(entry.Categories[0])
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			ci, cj := category(entries[i]), category(entries[j])
+			if ci != cj {
+				return ci < cj
+			}
+			return byName(i, j)
+		})
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", by)
+	}
+
+	options.Order = templateFilenames(entries)
+	return a.SyncTemplates(nil, nil, options)
+}
+
+// PinTemplates moves the given templates to the top of templates.json, in the given order
+func (a *App) PinTemplates(filenames []string, options SyncOptions) (*SyncResult, error) {
+	entries, err := a.currentTemplates("PinTemplates", &options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filename := range filenames {
+		if indexOfTemplate(entries, filename) < 0 {
+			return nil, unorderedTemplateError(filename)
+		}
+	}
+
+	options.Order = filenames
+	return a.SyncTemplates(nil, nil, options)
+}
+
+// currentTemplates reads the templates.json entries to reorder. If options
+// carries no revision, it is set to the revision read, so that the reorder
+// is refused if the file changes before it is written.
+func (a *App) currentTemplates(op string, options *SyncOptions) ([]DeviceTemplate, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	content, data, err := a.readTemplatesJSON(op)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Revision == "" {
+		options.Revision = templatesRevision(content)
+	}
+
+	return data.Templates, nil
+}
+
+// unorderedTemplateError is the error for reordering a template that is not
+// in templates.json. User templates have no position the app can change.
+func unorderedTemplateError(filename string) error {
+	if userTemplateID.MatchString(filename) {
+		return fmt.Errorf("%s is a user template, which has no position in templates.json", filename)
+	}
+	return fmt.Errorf("template %s not found on the device", filename)
+}
+
+// orderTemplates returns the entries with the filenames in order first, followed
+// by the remaining entries in their current order
+func orderTemplates(entries []DeviceTemplate, order []string) []DeviceTemplate {
+	position := make(map[string]int, len(order))
+	for i, filename := range order {
+		if _, ok := position[filename]; !ok {
+			position[filename] = i
+		}
+	}
+
+	ordered := append([]DeviceTemplate(nil), entries...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, iListed := position[ordered[i].Filename]
+		pj, jListed := position[ordered[j].Filename]
+		if iListed && jListed {
+			return pi < pj
+		}
+		return iListed && !jListed
+	})
+
+	return ordered
+}
+
+// templateFilenames returns the filenames of the entries, in order
+func templateFilenames(entries []DeviceTemplate) []string {
+	filenames := make([]string, len(entries))
+	for i, entry := range entries {
+		filenames[i] = entry.Filename
+	}
+	return filenames
+}
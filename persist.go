@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// The persistent store lives on the home partition, which firmware updates
+// keep. The systemd unit has to live on the root partition, which they
+// replace, so a copy of it is kept in the store to re-create it from.
+const (
+	persistDir          = "/home/root/.local/share/remarkable-template-manager"
+	persistTemplatesDir = persistDir + "/templates"
+	// persistEntriesPath holds the templates.json entries to merge, one compact JSON object per line
+	persistEntriesPath  = persistDir + "/entries"
+	persistScriptPath   = persistDir + "/restore-templates.sh"
+	persistUnitName     = "remarkable-template-manager.service"
+	persistUnitCopyPath = persistDir + "/" + persistUnitName
+	persistUnitPath     = "/etc/systemd/system/" + persistUnitName
+)
+
+// persistScript copies the stored images back into the templates directory
+// and adds every stored entry that templates.json lacks. Without a JSON
+// parser on the device, the entries are inserted after the line opening the
+// templates array, and only when the file has the expected layout. The merged
+// file is written next to the original and only replaces it if it holds
+// exactly the added entries more. The root filesystem is returned to the mode
+// it had.
+const persistScript = `#!/bin/sh
+# Restores the custom templates stored by reMarkable Template Manager after a
+# firmware update replaced ` + templatesDir + `
+STORE=` + persistDir + `
+TEMPLATES=` + templatesDir + `
+JSON=$TEMPLATES/templates.json
+OPENING='^ *"templates": *\[ *$'
+
+[ -f "$STORE/entries" ] && [ -f "$JSON" ] || exit 0
+
+ROOT_MODE=$(awk '$2 == "/" { split($4, options, ","); mode = options[1] } END { print mode }' /proc/mounts)
+if [ "$ROOT_MODE" = ro ]; then
+	mount -o remount,rw / || exit 1
+	trap 'mount -o remount,ro /' EXIT
+fi
+
+for f in "$STORE"/templates/*; do
+	[ -f "$f" ] || continue
+	cmp -s "$f" "$TEMPLATES/${f##*/}" || cp "$f" "$TEMPLATES/${f##*/}"
+done
+
+rm -f "$STORE/missing"
+count=0
+while IFS= read -r entry; do
+	case "$entry" in
+		'{'*'}') ;;
+		*) continue ;;
+	esac
+	name=$(printf '%s\n' "$entry" | sed -n 's/.*"filename":"\([^"]*\)".*/\1/p')
+	[ -n "$name" ] || continue
+	grep -qF "\"filename\":\"$name\"" "$JSON" && continue
+	grep -qF "\"filename\": \"$name\"" "$JSON" && continue
+	printf '%s,\n' "$entry" >> "$STORE/missing"
+	count=$((count + 1))
+	echo "Restoring template $name"
+done < "$STORE/entries"
+[ "$count" -gt 0 ] || exit 0
+
+# The entries end with a comma, so the array must open on a line of its own
+# and be followed by an existing entry
+if [ "$(grep -c "$OPENING" "$JSON")" != 1 ]; then
+	echo "templates.json has an unexpected layout, not restoring templates" >&2
+	exit 1
+fi
+case "$(sed -n "/$OPENING/{n;p;}" "$JSON")" in
+	*'{'*) ;;
+	*) echo "templates.json has no entries to insert before, not restoring templates" >&2; exit 1 ;;
+esac
+
+before=$(grep -c '"filename"' "$JSON")
+sed "/$OPENING/r $STORE/missing" "$JSON" > "$JSON.new" || exit 1
+after=$(grep -c '"filename"' "$JSON.new")
+if [ "$after" != $((before + count)) ]; then
+	echo "merging the stored entries failed, templates.json was left unchanged" >&2
+	rm -f "$JSON.new"
+	exit 1
+fi
+cp "$JSON" "$STORE/templates.json.orig" && mv "$JSON.new" "$JSON" && sync
+`
+
+// persistUnit runs the restore script at boot, before the UI reads templates.json
+const persistUnit = `[Unit]
+Description=Restore custom templates stored by reMarkable Template Manager
+RequiresMountsFor=/home/root
+Before=xochitl.service
+
+[Service]
+Type=oneshot
+ExecStart=/bin/sh ` + persistScriptPath + `
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// InstallPersistence stores the device's custom templates under /home/root
+// and installs a systemd unit that merges them back into the templates
+// directory at every boot. The store is refreshed after every sync while
+// the hook is installed. Firmware updates remove the unit; the app re-creates
+// it from the copy in the store when it next connects, see repairPersistence.
+func (a *App) InstallPersistence() (*PersistenceStatus, error) {
+	log.Println("[Persistence] Installing template restore hook...")
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	if err := a.installPersistenceHook("Persistence"); err != nil {
+		return nil, err
+	}
+	if err := a.writePersistentTemplates("Persistence"); err != nil {
+		return nil, err
+	}
+
+	status, err := a.VerifyPersistence()
+	if err != nil {
+		return nil, err
+	}
+	if !status.OK {
+		return status, fmt.Errorf("the restore hook was installed but could not be verified")
+	}
+
+	log.Printf("[Persistence] SUCCESS: %d templates stored in %s", status.Templates, persistDir)
+	return status, nil
+}
+
+// installPersistenceHook writes the restore script and the copy of the unit
+// to the store, then installs and enables the unit from that copy
+func (a *App) installPersistenceHook(op string) error {
+	if _, err := a.runCommand(op, "mkdir -p "+shellQuote(persistTemplatesDir)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", persistDir, err)
+	}
+	if err := a.runCommandWithInput(op, "cat > "+shellQuote(persistScriptPath), []byte(persistScript)); err != nil {
+		return fmt.Errorf("failed to write restore script: %w", err)
+	}
+	if err := a.runCommandWithInput(op, "cat > "+shellQuote(persistUnitCopyPath), []byte(persistUnit)); err != nil {
+		return fmt.Errorf("failed to write systemd unit: %w", err)
+	}
+
+	return a.withWritableRoot(op, func() error {
+		if _, err := a.runCommand(op, fmt.Sprintf("cp %s %s", shellQuote(persistUnitCopyPath), shellQuote(persistUnitPath))); err != nil {
+			return fmt.Errorf("failed to install systemd unit: %w", err)
+		}
+		if _, err := a.runCommand(op, "systemctl daemon-reload && systemctl enable "+persistUnitName); err != nil {
+			return fmt.Errorf("failed to enable systemd unit: %w", err)
+		}
+		return nil
+	})
+}
+
+// repairPersistence re-creates the restore hook if it was installed but its
+// unit is gone or outdated, as after a firmware update. When the unit was
+// missing, the device booted without restoring the templates, so the restore
+// script is also run once. It does nothing if the hook was never installed.
+func (a *App) repairPersistence(op string) error {
+	status, err := a.VerifyPersistence()
+	if err != nil {
+		return err
+	}
+	if !status.ScriptInstalled || status.OK {
+		return nil
+	}
+
+	log.Printf("[%s] Re-creating the template restore hook...", op)
+	if err := a.installPersistenceHook(op); err != nil {
+		return err
+	}
+	if status.UnitInstalled {
+		return nil
+	}
+
+	err = a.withWritableRoot(op, func() error {
+		output, err := a.runCommand(op, "/bin/sh "+shellQuote(persistScriptPath))
+		if text := strings.TrimSpace(string(output)); text != "" {
+			log.Printf("[%s] %s", op, text)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore the stored templates: %w", err)
+	}
+
+	log.Printf("[%s] Restore hook re-created and stored templates restored", op)
+	return nil
+}
+
+// VerifyPersistence reports whether the restore script, the systemd unit and
+// the stored templates are in place on the device
+func (a *App) VerifyPersistence() (*PersistenceStatus, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	cmd := fmt.Sprintf(`printf '%%s\n' "$(sha256sum %s 2>/dev/null | cut -c1-64)" "$(sha256sum %s 2>/dev/null | cut -c1-64)" "$(systemctl is-enabled %s 2>/dev/null)" "$(cat %s 2>/dev/null | wc -l)"`,
+		shellQuote(persistScriptPath), shellQuote(persistUnitPath), persistUnitName, shellQuote(persistEntriesPath))
+	output, err := a.runCommand("Persistence", cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the restore hook: %w", err)
+	}
+	lines := strings.Split(string(output), "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("failed to check the restore hook: unexpected output %q", string(output))
+	}
+
+	status := &PersistenceStatus{
+		ScriptInstalled: lines[0] != "",
+		ScriptCurrent:   lines[0] == sha256Hex([]byte(persistScript)),
+		UnitInstalled:   lines[1] != "",
+		UnitCurrent:     lines[1] == sha256Hex([]byte(persistUnit)),
+		Enabled:         lines[2] == "enabled",
+	}
+	status.Templates, _ = strconv.Atoi(strings.TrimSpace(lines[3]))
+	status.OK = status.ScriptCurrent && status.UnitCurrent && status.Enabled
+
+	log.Printf("[Persistence] Script installed: %t, unit installed: %t, enabled: %t, %d templates stored",
+		status.ScriptInstalled, status.UnitInstalled, status.Enabled, status.Templates)
+	return status, nil
+}
+
+// UninstallPersistence disables and removes the systemd unit and deletes the
+// stored templates. Templates already in the templates directory stay.
+func (a *App) UninstallPersistence() error {
+	log.Println("[Persistence] Removing template restore hook...")
+
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+
+	cmd := fmt.Sprintf("systemctl disable %s 2>/dev/null; rm -f %s && systemctl daemon-reload && rm -rf %s",
+		persistUnitName, shellQuote(persistUnitPath), shellQuote(persistDir))
+	err := a.withWritableRoot("Persistence", func() error {
+		_, err := a.runCommand("Persistence", cmd)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove the restore hook: %w", err)
+	}
+
+	log.Println("[Persistence] SUCCESS: Restore hook removed")
+	return nil
+}
+
+// refreshPersistentTemplates updates the store after a sync, if the hook is installed
+func (a *App) refreshPersistentTemplates(op string) error {
+	output, err := a.runCommand(op, fmt.Sprintf("test -f %s && echo yes || true", shellQuote(persistScriptPath)))
+	if err != nil {
+		return fmt.Errorf("failed to check the restore hook: %w", err)
+	}
+	if strings.TrimSpace(string(output)) != "yes" {
+		return nil
+	}
+
+	return a.writePersistentTemplates(op)
+}
+
+// writePersistentTemplates replaces the store with the images and entries of
+// the custom templates currently on the device
+func (a *App) writePersistentTemplates(op string) error {
+	_, data, err := a.readTemplatesJSON(op)
+	if err != nil {
+		return err
+	}
+	existingFiles, err := a.listTemplateFiles(op)
+	if err != nil {
+		return err
+	}
+	stock := a.stockTemplates(op)
+
+	var entries []byte
+	var files []string
+	for _, entry := range data.Templates {
+		if stock[entry.Filename] {
+			continue
+		}
+		entry.Stock = false
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal template entry: %w", err)
+		}
+		entries = append(append(entries, line...), '\n')
+
+		for _, ext := range templateImageExts {
+			if existingFiles[entry.Filename+ext] {
+				files = append(files, shellQuote(path.Join(templatesDir, entry.Filename+ext)))
+			}
+		}
+	}
+
+	// Copy into a new folder first so a failed copy keeps the previous store
+	staging := persistTemplatesDir + ".new"
+	cmd := fmt.Sprintf("rm -rf %s && mkdir -p %s", shellQuote(staging), shellQuote(staging))
+	if len(files) > 0 {
+		cmd += fmt.Sprintf(" && cp %s %s/", strings.Join(files, " "), shellQuote(staging))
+	}
+	cmd += fmt.Sprintf(" && rm -rf %s && mv %s %s", shellQuote(persistTemplatesDir), shellQuote(staging), shellQuote(persistTemplatesDir))
+	if _, err := a.runCommand(op, cmd); err != nil {
+		return fmt.Errorf("failed to store custom templates: %w", err)
+	}
+	if err := a.runCommandWithInput(op, "cat > "+shellQuote(persistEntriesPath), entries); err != nil {
+		return fmt.Errorf("failed to store template entries: %w", err)
+	}
+
+	log.Printf("[%s] Stored %d custom templates in %s", op, len(files), persistDir)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PlanReplaceTemplate computes the plan for replacing the image of an existing
+// template. The templates.json entry is left as it is; if the image type
+// changes, the image of the old type is deleted. A template with an SVG is of
+// the SVG type, a PNG next to it is its thumbnail and is kept when an SVG
+// replaces the SVG.
+func (a *App) PlanReplaceTemplate(filename string, localPath string) (*SyncPlan, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	ext := strings.ToLower(filepath.Ext(localPath))
+	if ext != ".svg" && ext != ".png" {
+		return nil, fmt.Errorf("invalid file type: only SVG and PNG files are allowed")
+	}
+
+	digest, err := localFileDigest(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	before, data, err := a.readTemplatesJSON("ReplaceTemplate")
+	if err != nil {
+		return nil, err
+	}
+	if indexOfTemplate(data.Templates, filename) < 0 {
+		return nil, fmt.Errorf("template %s not found on the device", filename)
+	}
+
+	existingFiles, err := a.listTemplateFiles("ReplaceTemplate")
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{
+		Revision: templatesRevision(before),
+		Uploads: []PlannedUpload{{
+			Filename:   filename,
+			LocalPath:  localPath,
+			RemotePath: path.Join(templatesDir, filename+ext),
+			Size:       digest.Size,
+			SHA256:     digest.SHA256,
+			Overwrite:  existingFiles[filename+ext],
+		}},
+		Deletions: []string{},
+		Added:     []DeviceTemplate{},
+		Removed:   []DeviceTemplate{},
+		Changed:   []TemplateChange{},
+		Before:    string(before),
+		After:     string(before),
+	}
+
+	// Remove the image of the old type so the device doesn't keep using it
+	oldType := ""
+	switch {
+	case existingFiles[filename+".svg"]:
+		oldType = ".svg"
+	case existingFiles[filename+".png"]:
+		oldType = ".png"
+	}
+	if oldType != "" && oldType != ext {
+		plan.Deletions = append(plan.Deletions, path.Join(templatesDir, filename+oldType))
+	}
+
+	plan.StockChanges = a.stockChanges("ReplaceTemplate", plan)
+
+	return plan, nil
+}
+
+// ReplaceTemplateImage uploads a new image for an existing template, keeping
+// its templates.json entry, position and categories. The old image files are
+// saved to the local sync history so the replacement can be undone, see
+// UndoSync. They are also copied to a folder on the device for the duration
+// of the replacement, which is only kept if it could not be rolled back.
+// Built-in templates are only replaced when allowStockChanges is set.
+func (a *App) ReplaceTemplateImage(filename string, localPath string, allowStockChanges bool) (*SyncResult, error) {
+	plan, err := a.PlanReplaceTemplate(filename, localPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkStockChanges("ReplaceTemplate", plan, allowStockChanges); err != nil {
+		return nil, err
+	}
+
+	// Back up every image file the replacement overwrites or deletes
+	var oldFiles []string
+	for _, upload := range plan.Uploads {
+		if upload.Overwrite {
+			oldFiles = append(oldFiles, shellQuote(upload.RemotePath))
+		}
+	}
+	for _, remotePath := range plan.Deletions {
+		oldFiles = append(oldFiles, shellQuote(remotePath))
+	}
+
+	var result *SyncResult
+	err = a.withWritableRoot("ReplaceTemplate", func() error {
+		backupDir := ""
+		if len(oldFiles) > 0 {
+			backupDir = fmt.Sprintf("%s/replaced_%s", backupRootDir, time.Now().Format("20060102_150405"))
+			cmd := fmt.Sprintf("mkdir -p %s && cp -p %s %s/", shellQuote(backupDir), strings.Join(oldFiles, " "), shellQuote(backupDir))
+			if _, err := a.runCommand("ReplaceTemplate", cmd); err != nil {
+				return fmt.Errorf("failed to back up the current image: %w", err)
+			}
+			log.Printf("[ReplaceTemplate] Backed up %d file(s) to %s", len(oldFiles), backupDir)
+		}
+
+		var err error
+		result, err = a.ApplySyncPlan(plan, SyncOptions{AllowStockChanges: allowStockChanges, Snapshot: true})
+		if backupDir == "" {
+			return err
+		}
+		if result != nil && result.Status == SyncRollbackFailed {
+			// The device copy may be the only one left of the old image
+			result.Backup = backupDir
+			return err
+		}
+		if _, rmErr := a.runCommand("ReplaceTemplate", "rm -rf "+shellQuote(backupDir)); rmErr != nil {
+			log.Printf("[ReplaceTemplate] WARNING: Failed to remove %s: %v", backupDir, rmErr)
+			if result != nil {
+				result.Backup = backupDir
+			}
+		}
+		return err
+	})
+
+	return result, err
+}
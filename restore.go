@@ -0,0 +1,625 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backup locations reported in BackupInfo.Location
+const (
+	BackupOnDevice = "device"
+	BackupLocal    = "local"
+)
+
+// fileDigest is the size and SHA-256 hash of a file
+type fileDigest struct {
+	Size   int64
+	SHA256 string
+}
+
+// backupContents is the content of a backup needed to compare and restore it
+type backupContents struct {
+	templatesJSON []byte
+	files         map[string]fileDigest
+	// fetch copies files of the backup to a local folder, under their names
+	fetch func(names []string, localDir string) error
+}
+
+// ListBackups returns the backups on the device and in the local backup folder, newest first
+func (a *App) ListBackups() ([]BackupInfo, error) {
+	backups := []BackupInfo{}
+
+	if a.sshClient != nil {
+		deviceBackups, err := a.listDeviceBackups()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, deviceBackups...)
+	}
+
+	localBackups, err := listLocalBackups()
+	if err != nil {
+		return nil, err
+	}
+	backups = append(backups, localBackups...)
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// DiffBackup compares a backup with the current state of the device. The
+// result is the plan a full RestoreBackup would apply.
+func (a *App) DiffBackup(id string) (*SyncPlan, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	contents, err := a.loadBackup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.planRestore(contents, nil, "")
+}
+
+// RestoreBackup restores a backup to the device, either completely or only the
+// templates with the given filenames. A backup of the current state is taken
+// on the device first. The restore is applied as a transaction, and old
+// backups are only pruned once it is committed, so the backup being restored
+// is never deleted before it is used.
+func (a *App) RestoreBackup(id string, filenames []string, allowStockChanges bool) (*SyncResult, error) {
+	log.Printf("[Restore] Restoring backup %s...", id)
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	contents, err := a.loadBackup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "remarkable-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary folder: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	plan, err := a.planRestore(contents, filenames, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkStockChanges("Restore", plan, allowStockChanges); err != nil {
+		return nil, err
+	}
+
+	var result *SyncResult
+	err = a.withWritableRoot("Restore", func() error {
+		safetyBackup, err := a.backupTemplates()
+		if err != nil {
+			return fmt.Errorf("failed to back up the current templates before restoring: %w", err)
+		}
+
+		result, err = a.ApplySyncPlan(plan, SyncOptions{AllowStockChanges: allowStockChanges})
+		if result != nil {
+			result.Backup = safetyBackup
+		}
+		return err
+	})
+	if err == nil && result != nil && result.Status == SyncCommitted {
+		a.applyBackupRetention()
+	}
+
+	return result, err
+}
+
+// planRestore builds the plan restoring contents to the device. With no
+// filenames the whole backup is restored, otherwise only the given templates.
+// Files to upload are fetched into localDir; an empty localDir only plans.
+func (a *App) planRestore(contents *backupContents, filenames []string, localDir string) (*SyncPlan, error) {
+	var backupData templatesJSON
+	if err := json.Unmarshal(contents.templatesJSON, &backupData); err != nil {
+		return nil, fmt.Errorf("failed to parse the backup's templates.json: %w", err)
+	}
+
+	before, current, err := a.readTemplatesJSON("Restore")
+	if err != nil {
+		return nil, err
+	}
+	currentFiles, err := a.remoteFileDigests("Restore", templatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{
+		Revision:  templatesRevision(before),
+		Uploads:   []PlannedUpload{},
+		Deletions: []string{},
+		Before:    string(before),
+	}
+
+	// Decide which files to restore and the resulting templates.json. Only
+	// the template files directly in the templates directory are compared,
+	// anything in subfolders is left alone.
+	restoreFiles := make(map[string]bool)
+	if len(filenames) == 0 {
+		for name := range contents.files {
+			if !strings.Contains(name, "/") {
+				restoreFiles[name] = true
+			}
+		}
+		for name := range currentFiles {
+			if strings.Contains(name, "/") {
+				continue
+			}
+			if _, ok := contents.files[name]; !ok && name != path.Base(templatesJSONPath) {
+				plan.Deletions = append(plan.Deletions, path.Join(templatesDir, name))
+			}
+		}
+		sort.Strings(plan.Deletions)
+		plan.After = string(contents.templatesJSON)
+	} else {
+		entries := append([]DeviceTemplate{}, current.Templates...)
+		for _, filename := range filenames {
+			i := indexOfTemplate(backupData.Templates, filename)
+			if i < 0 {
+				return nil, fmt.Errorf("template %s not found in the backup", filename)
+			}
+			if j := indexOfTemplate(entries, filename); j >= 0 {
+				entries[j] = backupData.Templates[i]
+			} else {
+				entries = append(entries, backupData.Templates[i])
+			}
+			for _, ext := range templateImageExts {
+				if _, ok := contents.files[filename+ext]; ok {
+					restoreFiles[filename+ext] = true
+				}
+			}
+		}
+
+		plan.After, err = updatedTemplatesJSON(before, current, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	delete(restoreFiles, path.Base(templatesJSONPath))
+
+	// Only upload files that are missing or different on the device
+	names := make([]string, 0, len(restoreFiles))
+	for name := range restoreFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fetch []string
+	for _, name := range names {
+		digest := contents.files[name]
+		currentDigest, exists := currentFiles[name]
+		if exists && currentDigest == digest {
+			continue
+		}
+
+		upload := PlannedUpload{
+			Filename:   strings.TrimSuffix(name, path.Ext(name)),
+			RemotePath: path.Join(templatesDir, name),
+			Size:       digest.Size,
+			SHA256:     digest.SHA256,
+			Overwrite:  exists,
+		}
+		if localDir != "" {
+			upload.LocalPath = filepath.Join(localDir, name)
+			fetch = append(fetch, name)
+		}
+		plan.Uploads = append(plan.Uploads, upload)
+	}
+	if len(fetch) > 0 {
+		if err := contents.fetch(fetch, localDir); err != nil {
+			return nil, fmt.Errorf("failed to read the files from the backup: %w", err)
+		}
+	}
+
+	var after templatesJSON
+	if err := json.Unmarshal([]byte(plan.After), &after); err != nil {
+		return nil, fmt.Errorf("failed to parse the restored templates.json: %w", err)
+	}
+	plan.Added, plan.Removed, plan.Changed = diffTemplateEntries(current.Templates, after.Templates)
+	plan.Diff = templatesJSONDiff(plan.Before, plan.After)
+
+	plan.StockChanges = a.stockChanges("Restore", plan)
+
+	return plan, nil
+}
+
+// diffTemplateEntries compares two lists of templates.json entries by filename
+func diffTemplateEntries(before, after []DeviceTemplate) ([]DeviceTemplate, []DeviceTemplate, []TemplateChange) {
+	added := []DeviceTemplate{}
+	removed := []DeviceTemplate{}
+	changed := []TemplateChange{}
+
+	for _, entry := range after {
+		i := indexOfTemplate(before, entry.Filename)
+		if i < 0 {
+			added = append(added, entry)
+		} else if !reflect.DeepEqual(before[i], entry) {
+			changed = append(changed, TemplateChange{Before: before[i], After: entry})
+		}
+	}
+	for _, entry := range before {
+		if indexOfTemplate(after, entry.Filename) < 0 {
+			removed = append(removed, entry)
+		}
+	}
+
+	return added, removed, changed
+}
+
+// loadBackup reads the contents of the backup with the given ID
+func (a *App) loadBackup(id string) (*backupContents, error) {
+	location, name, ok := strings.Cut(id, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid backup ID %q", id)
+	}
+
+	switch location {
+	case BackupOnDevice:
+		return a.loadDeviceBackup(name)
+	case BackupLocal:
+		return loadLocalBackup(name)
+	}
+
+	return nil, fmt.Errorf("invalid backup ID %q", id)
+}
+
+// listDeviceBackups lists the backup_* folders made by BackupTemplates on the device
+func (a *App) listDeviceBackups() ([]BackupInfo, error) {
+	cmd := fmt.Sprintf(`cd %s 2>/dev/null || exit 0
+for d in backup_*; do
+	[ -d "$d" ] || continue
+	printf '%%s\t%%s\t%%s\n' "$d" "$(du -sk "$d" | cut -f1)" "$(grep -o '"filename"' "$d/templates.json" 2>/dev/null | wc -l)"
+done`, shellQuote(backupRootDir))
+
+	output, err := a.runCommand("ListBackups", cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device backups: %w", err)
+	}
+
+	backups := []BackupInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		createdAt, err := time.ParseInLocation("20060102_150405", strings.TrimPrefix(fields[0], "backup_"), time.Local)
+		if err != nil {
+			continue
+		}
+		sizeKB, _ := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		count, _ := strconv.Atoi(strings.TrimSpace(fields[2]))
+
+		backups = append(backups, BackupInfo{
+			ID:        BackupOnDevice + ":" + fields[0],
+			Location:  BackupOnDevice,
+			Path:      path.Join(backupRootDir, fields[0]),
+			CreatedAt: createdAt,
+			Size:      sizeKB * 1024,
+			Templates: count,
+		})
+	}
+
+	return backups, nil
+}
+
+// loadDeviceBackup reads the file digests and templates.json of a device backup
+func (a *App) loadDeviceBackup(name string) (*backupContents, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+	if name != path.Base(name) || !strings.HasPrefix(name, "backup_") {
+		return nil, fmt.Errorf("invalid device backup %q", name)
+	}
+	dir := path.Join(backupRootDir, name)
+
+	templatesData, err := a.runCommand("Restore", "cat "+shellQuote(path.Join(dir, "templates.json")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the backup's templates.json: %w", err)
+	}
+
+	files, err := a.remoteFileDigests("Restore", dir)
+	if err != nil {
+		return nil, err
+	}
+	delete(files, backupManifestFile)
+
+	return &backupContents{
+		templatesJSON: templatesData,
+		files:         files,
+		fetch: func(names []string, localDir string) error {
+			for _, name := range names {
+				data, err := a.runCommand("Restore", "cat "+shellQuote(path.Join(dir, name)))
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				if err := os.WriteFile(filepath.Join(localDir, name), data, 0600); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// remoteFileDigests returns the size and SHA-256 of each file below a device
+// folder, keyed by path relative to the folder
+func (a *App) remoteFileDigests(op, dir string) (map[string]fileDigest, error) {
+	cmd := fmt.Sprintf(`cd %s || exit 1; find . -type f | while IFS= read -r f; do printf '%%s ' "$(stat -c %%s "$f")" && sha256sum "$f"; done`, shellQuote(dir))
+	output, err := a.runCommand(op, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash files in %s: %w", dir, err)
+	}
+
+	// Each line is "<size> <sha256>  ./<name>"
+	files := make(map[string]fileDigest)
+	for _, line := range strings.Split(string(output), "\n") {
+		size, rest, ok := strings.Cut(line, " ")
+		if !ok || len(rest) < 66 {
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			continue
+		}
+		files[strings.TrimPrefix(rest[66:], "./")] = fileDigest{Size: n, SHA256: rest[:64]}
+	}
+
+	return files, nil
+}
+
+// listLocalBackups lists the archives in the local backup folder
+func listLocalBackups() ([]BackupInfo, error) {
+	settings, err := loadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	if settings.LocalBackupDir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(settings.LocalBackupDir, "remarkable-templates_*.tar.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local backups: %w", err)
+	}
+
+	backups := []BackupInfo{}
+	for _, archivePath := range paths {
+		// Only the metadata and templates.json are needed for the list
+		archive, err := readBackupArchive(archivePath, false)
+		if err != nil {
+			log.Printf("[ListBackups] WARNING: Skipping %s: %v", archivePath, err)
+			continue
+		}
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			continue
+		}
+
+		var data templatesJSON
+		json.Unmarshal(archive.templatesJSON, &data)
+
+		metadata := archive.metadata
+		backups = append(backups, BackupInfo{
+			ID:        BackupLocal + ":" + filepath.Base(archivePath),
+			Location:  BackupLocal,
+			Path:      archivePath,
+			CreatedAt: metadata.CreatedAt,
+			Size:      info.Size(),
+			Templates: len(data.Templates),
+			Metadata:  &metadata,
+		})
+	}
+
+	return backups, nil
+}
+
+// loadLocalBackup reads the file digests and templates.json of a local archive
+func loadLocalBackup(name string) (*backupContents, error) {
+	archivePath, err := localBackupPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := readBackupArchive(archivePath, true)
+	if err != nil {
+		return nil, err
+	}
+	if archive.templatesJSON == nil {
+		return nil, fmt.Errorf("the backup contains no templates.json")
+	}
+
+	return &backupContents{
+		templatesJSON: archive.templatesJSON,
+		files:         archive.files,
+		fetch: func(names []string, localDir string) error {
+			return extractBackupFiles(archivePath, names, localDir)
+		},
+	}, nil
+}
+
+// localBackupPath returns the path of a local backup archive from its name
+func localBackupPath(name string) (string, error) {
+	settings, err := loadSettings()
+	if err != nil {
+		return "", fmt.Errorf("failed to load settings: %w", err)
+	}
+	if name != filepath.Base(name) || settings.LocalBackupDir == "" {
+		return "", fmt.Errorf("invalid local backup %q", name)
+	}
+
+	return filepath.Join(settings.LocalBackupDir, name), nil
+}
+
+// backupArchive is the content of a local backup archive, without the image data
+type backupArchive struct {
+	metadata BackupMetadata
+	// manifest is the raw manifest, nil for archives made before manifests existed
+	manifest []byte
+	// templatesJSON is the backed up templates.json, nil if the archive has none
+	templatesJSON []byte
+	// files holds the digests of the templates directory's files by path
+	// relative to it, nil unless requested
+	files map[string]fileDigest
+}
+
+// readBackupArchive reads a backup archive written by DownloadBackup. The
+// archive is streamed, only the metadata, manifest and templates.json are
+// kept in memory, and with digests every file of the templates directory is
+// hashed as it is read.
+func readBackupArchive(archivePath string, digests bool) (*backupArchive, error) {
+	archive := &backupArchive{}
+	if digests {
+		archive.files = make(map[string]fileDigest)
+	}
+
+	err := walkBackupArchive(archivePath, func(name string, r io.Reader) error {
+		switch name {
+		case backupMetadataFile:
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &archive.metadata); err != nil {
+				return fmt.Errorf("failed to parse backup metadata: %w", err)
+			}
+			return nil
+		case backupManifestFile:
+			data, err := io.ReadAll(r)
+			archive.manifest = data
+			return err
+		}
+
+		fileName, ok := backupArchiveFile(name)
+		if !ok {
+			return nil
+		}
+		if fileName == path.Base(templatesJSONPath) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			archive.templatesJSON = data
+			if digests {
+				archive.files[fileName] = fileDigest{Size: int64(len(data)), SHA256: sha256Hex(data)}
+			}
+			return nil
+		}
+		if !digests {
+			return nil
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, r)
+		if err != nil {
+			return err
+		}
+		archive.files[fileName] = fileDigest{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// extractBackupFiles writes the named files of the templates directory in a
+// backup archive to a local folder, in a single pass over the archive
+func extractBackupFiles(archivePath string, names []string, localDir string) error {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	err := walkBackupArchive(archivePath, func(name string, r io.Reader) error {
+		fileName, ok := backupArchiveFile(name)
+		if !ok || !wanted[fileName] {
+			return nil
+		}
+		delete(wanted, fileName)
+
+		f, err := os.OpenFile(filepath.Join(localDir, fileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range wanted {
+		return fmt.Errorf("%s is not in the backup", name)
+	}
+	return nil
+}
+
+// backupArchiveFile returns the path relative to the templates directory of
+// a member of a backup archive, if it is one of the directory's files
+func backupArchiveFile(name string) (string, bool) {
+	prefix := path.Base(templatesDir) + "/"
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return name[len(prefix):], true
+}
+
+// walkBackupArchive calls fn with the name and content of each regular file
+// of a backup archive, in archive order
+func walkBackupArchive(archivePath string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := fn(strings.TrimPrefix(header.Name, "./"), tarReader); err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// userTemplateMetadataSize is the space allowed for the metadata file written
+// with each user template
+const userTemplateMetadataSize = 1 << 10
+
+// deviceSpaceMargin is the free space left over after a backup or sync, so
+// the device's root filesystem is never filled completely
+const deviceSpaceMargin = 5 << 20
+
+// PruneBackups deletes the device backups the retention policy does not keep
+// and returns the paths it deleted. The newest backup is always kept.
+func (a *App) PruneBackups() ([]string, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	settings, err := loadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	retention := settings.BackupRetention
+	if retention.KeepLast == 0 && retention.KeepMonthly == 0 {
+		return []string{}, nil
+	}
+
+	backups, err := a.listDeviceBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []string{}
+	keep := retainedBackups(backups, retention)
+	var paths []string
+	for _, backup := range backups {
+		if !keep[backup.ID] {
+			paths = append(paths, shellQuote(backup.Path))
+			pruned = append(pruned, backup.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return pruned, nil
+	}
+
+	log.Printf("[Backup] Pruning %d backup(s): %s", len(pruned), strings.Join(pruned, ", "))
+	err = a.withWritableRoot("PruneBackups", func() error {
+		_, err := a.runCommand("PruneBackups", "rm -rf "+strings.Join(paths, " "))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete old backups: %w", err)
+	}
+
+	return pruned, nil
+}
+
+// retainedBackups returns the IDs of the backups the retention policy keeps
+func retainedBackups(backups []BackupInfo, retention BackupRetention) map[string]bool {
+	sorted := append([]BackupInfo(nil), backups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	keep := make(map[string]bool)
+	if len(sorted) > 0 {
+		keep[sorted[0].ID] = true
+	}
+
+	for i := 0; i < retention.KeepLast && i < len(sorted); i++ {
+		keep[sorted[i].ID] = true
+	}
+
+	// Walking from newest to oldest, the last backup seen in a month is its oldest
+	oldestInMonth := make(map[string]string)
+	var months []string
+	for _, backup := range sorted {
+		month := backup.CreatedAt.Format("2006-01")
+		if _, ok := oldestInMonth[month]; !ok {
+			months = append(months, month)
+		}
+		oldestInMonth[month] = backup.ID
+	}
+	for i := 0; i < retention.KeepMonthly && i < len(months); i++ {
+		keep[oldestInMonth[months[i]]] = true
+	}
+
+	return keep
+}
+
+// checkBackupSpace refuses a backup when the copy of the templates directory
+// would not fit on the device with the safety margin to spare
+func (a *App) checkBackupSpace() error {
+	needed, err := a.diskUsage("Backup", templatesDir)
+	if err != nil {
+		return err
+	}
+	available, err := a.freeSpace("Backup", templatesDir)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Backup] Templates directory size: %s, free space: %s", formatBytes(needed), formatBytes(available))
+	if needed+deviceSpaceMargin > available {
+		return fmt.Errorf("not enough free space on the device for a backup: %s needed, %s available; delete old backups or download backups to your computer instead",
+			formatBytes(needed+deviceSpaceMargin), formatBytes(available))
+	}
+
+	return nil
+}
+
+// checkSyncSpace refuses a plan whose uploads and templates.json would not
+// fit on the device with the safety margin to spare, and likewise for the
+// user templates on the home partition. Overwritten files are counted in
+// full, since each is truncated before its new content arrives.
+func (a *App) checkSyncSpace(plan *SyncPlan) error {
+	var needed int64
+	for _, upload := range plan.Uploads {
+		needed += upload.Size
+	}
+	if growth := int64(len(plan.After) - len(plan.Before)); growth > 0 {
+		needed += growth
+	}
+	if err := a.checkFreeSpace(templatesDir, needed); err != nil {
+		return err
+	}
+
+	var userNeeded int64
+	for _, tmpl := range plan.UserTemplates {
+		userNeeded += tmpl.Size + userTemplateMetadataSize
+	}
+	// The xochitl folder may not exist yet, its partition is mounted at /home
+	return a.checkFreeSpace("/home", userNeeded)
+}
+
+// checkFreeSpace refuses a sync writing needed bytes to the filesystem
+// holding remotePath, unless they fit with the safety margin to spare
+func (a *App) checkFreeSpace(remotePath string, needed int64) error {
+	if needed == 0 {
+		return nil
+	}
+
+	available, err := a.freeSpace("ApplySyncPlan", remotePath)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[ApplySyncPlan] Upload size on %s: %s, free space: %s", remotePath, formatBytes(needed), formatBytes(available))
+	if needed+deviceSpaceMargin > available {
+		return fmt.Errorf("not enough free space on the device for this sync: %s needed on %s, %s available; delete old backups or unused templates first",
+			formatBytes(needed+deviceSpaceMargin), remotePath, formatBytes(available))
+	}
+
+	return nil
+}
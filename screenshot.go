@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Framebuffer layout of the devices CaptureScreen supports. The rM1 exposes
+// its framebuffer as /dev/fb0; the rM2 renders in software, so the image is
+// read from xochitl's memory right after its /dev/fb0 mapping.
+const (
+	framebufferWidth  = 1404
+	framebufferHeight = 1872
+	// rm1LineWidth is the number of pixels per framebuffer line on the rM1
+	rm1LineWidth = 1408
+	// rm2FramebufferOffset is the distance of the image from the end of the /dev/fb0 mapping
+	rm2FramebufferOffset = 8
+	// rm2BGRAMinVersion is the first UI release using 4 bytes per pixel on the rM2
+	rm2BGRAMinVersion = "3.7"
+)
+
+// CaptureScreen reads the device's framebuffer and returns it as a PNG, to
+// check how templates actually render on the display
+func (a *App) CaptureScreen() (*Screenshot, error) {
+	log.Println("[CaptureScreen] Capturing screen...")
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	info, err := a.deviceInfo("CaptureScreen")
+	if err != nil {
+		return nil, err
+	}
+
+	var img image.Image
+	switch info.Model {
+	case ModelRM1:
+		img, err = a.captureRM1()
+	case ModelRM2:
+		img, err = a.captureRM2(versionAtLeast(info.XochitlVersion, rm2BGRAMinVersion))
+	default:
+		return nil, fmt.Errorf("screen capture is not supported on %s", info.Model)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode screenshot: %w", err)
+	}
+
+	log.Printf("[CaptureScreen] SUCCESS: %s PNG", formatBytes(int64(buf.Len())))
+	return &Screenshot{
+		Width:  framebufferWidth,
+		Height: framebufferHeight,
+		PNG:    buf.Bytes(),
+	}, nil
+}
+
+// SaveScreenshot captures the screen and saves the PNG to a file chosen in a
+// native dialog. It returns the path, or an empty string if the user cancelled.
+func (a *App) SaveScreenshot() (string, error) {
+	screenshot, err := a.CaptureScreen()
+	if err != nil {
+		return "", err
+	}
+
+	selection, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Screenshot",
+		DefaultFilename: fmt.Sprintf("remarkable-screen_%s.png", time.Now().Format("20060102_150405")),
+		Filters: []runtime.FileFilter{
+			{DisplayName: "PNG Images (*.png)", Pattern: "*.png"},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to open save dialog: %w", err)
+	}
+	if selection == "" {
+		return "", nil
+	}
+
+	if err := os.WriteFile(selection, screenshot.PNG, 0644); err != nil {
+		return "", fmt.Errorf("failed to save screenshot: %w", err)
+	}
+
+	return selection, nil
+}
+
+// captureRM1 reads the RGB565 framebuffer of the rM1
+func (a *App) captureRM1() (image.Image, error) {
+	lineBytes := rm1LineWidth * 2
+	cmd := fmt.Sprintf("dd if=/dev/fb0 bs=%d count=%d 2>/dev/null", lineBytes, framebufferHeight)
+	raw, err := a.readFramebuffer(cmd, lineBytes*framebufferHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, framebufferWidth, framebufferHeight))
+	for y := 0; y < framebufferHeight; y++ {
+		line := raw[y*lineBytes:]
+		for x := 0; x < framebufferWidth; x++ {
+			v := uint16(line[2*x]) | uint16(line[2*x+1])<<8
+			r, g, b := uint8(v>>11&0x1f), uint8(v>>5&0x3f), uint8(v&0x1f)
+			img.SetRGBA(x, y, color.RGBA{R: r<<3 | r>>2, G: g<<2 | g>>4, B: b<<3 | b>>2, A: 0xff})
+		}
+	}
+
+	return img, nil
+}
+
+// captureRM2 reads the image xochitl renders on the rM2. Older firmware uses
+// 16-bit grayscale, newer firmware 32-bit BGRA.
+func (a *App) captureRM2(bgra bool) (image.Image, error) {
+	bytesPerPixel := 2
+	if bgra {
+		bytesPerPixel = 4
+	}
+	size := framebufferWidth * framebufferHeight * bytesPerPixel
+
+	// The image starts right after the end of the /dev/fb0 mapping
+	output, err := a.runCommand("CaptureScreen", `pid=$(pidof xochitl) && echo "$pid" && grep -m 1 /dev/fb0 "/proc/$pid/maps"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the framebuffer, is xochitl running? %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("failed to find the framebuffer in xochitl's memory")
+	}
+	pid := strings.Fields(lines[0])[0]
+	addresses, _, _ := strings.Cut(lines[1], " ")
+	_, end, ok := strings.Cut(addresses, "-")
+	if !ok {
+		return nil, fmt.Errorf("failed to parse xochitl's memory map: %q", lines[1])
+	}
+	mappingEnd, err := strconv.ParseUint(end, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse xochitl's memory map: %w", err)
+	}
+
+	// Read whole pages from the page-aligned mapping end and drop the offset locally
+	const pageSize = 4096
+	offset := mappingEnd + rm2FramebufferOffset
+	skip := offset / pageSize
+	lead := int(offset % pageSize)
+	count := (lead + size + pageSize - 1) / pageSize
+	cmd := fmt.Sprintf("dd if=/proc/%s/mem bs=%d skip=%d count=%d 2>/dev/null", pid, pageSize, skip, count)
+	raw, err := a.readFramebuffer(cmd, lead+size)
+	if err != nil {
+		return nil, err
+	}
+	raw = raw[lead:]
+
+	rect := image.Rect(0, 0, framebufferWidth, framebufferHeight)
+	if !bgra {
+		img := image.NewGray16(rect)
+		for i := 0; i < framebufferWidth*framebufferHeight; i++ {
+			v := uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+			img.SetGray16(i%framebufferWidth, i/framebufferWidth, color.Gray16{Y: v})
+		}
+		return img, nil
+	}
+
+	img := image.NewRGBA(rect)
+	for i := 0; i < framebufferWidth*framebufferHeight; i++ {
+		p := raw[4*i : 4*i+4]
+		img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3] = p[2], p[1], p[0], 0xff
+	}
+	return img, nil
+}
+
+// readFramebuffer runs a command printing raw framebuffer bytes, compressing
+// them on the device to keep the transfer small, and checks the size
+func (a *App) readFramebuffer(cmd string, size int) ([]byte, error) {
+	var raw []byte
+	err := a.streamCommand("CaptureScreen", cmd+" | gzip -1", func(r io.Reader) error {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read framebuffer: %w", err)
+		}
+		raw, err = io.ReadAll(gzipReader)
+		if err != nil {
+			return fmt.Errorf("failed to read framebuffer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture the screen: %w", err)
+	}
+	if len(raw) < size {
+		return nil, fmt.Errorf("failed to capture the screen: read %d of %d bytes", len(raw), size)
+	}
+
+	return raw, nil
+}
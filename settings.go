@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// appSettings are the user's preferences, persisted in the app's data directory
+type appSettings struct {
+	// LocalBackupDir is the folder backups were last downloaded to
+	LocalBackupDir string `json:"localBackupDir,omitempty"`
+	// BackupRetention decides which device backups are kept after each backup
+	BackupRetention BackupRetention `json:"backupRetention"`
+}
+
+// GetBackupRetention returns the retention policy for backups on the device
+func (a *App) GetBackupRetention() (BackupRetention, error) {
+	settings, err := loadSettings()
+	if err != nil {
+		return BackupRetention{}, fmt.Errorf("failed to load settings: %w", err)
+	}
+	return settings.BackupRetention, nil
+}
+
+// SetBackupRetention saves the retention policy for backups on the device
+func (a *App) SetBackupRetention(retention BackupRetention) error {
+	if retention.KeepLast < 0 || retention.KeepMonthly < 0 {
+		return fmt.Errorf("invalid retention policy: counts cannot be negative")
+	}
+	if err := updateSettings(func(s *appSettings) { s.BackupRetention = retention }); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
+// settingsMu serialises reads and writes of the settings file
+var settingsMu sync.Mutex
+
+// loadSettings reads the saved settings, returning defaults if there are none
+func loadSettings() (appSettings, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	return readSettingsFile()
+}
+
+// updateSettings applies update to the saved settings and writes them back
+func updateSettings(update func(*appSettings)) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	settings, err := readSettingsFile()
+	if err != nil {
+		return err
+	}
+	update(&settings)
+
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(path, settings)
+}
+
+// readSettingsFile reads the settings file. The caller must hold settingsMu.
+func readSettingsFile() (appSettings, error) {
+	var settings appSettings
+
+	path, err := settingsPath()
+	if err != nil {
+		return settings, err
+	}
+	if err := readJSONFile(path, &settings); err != nil && !os.IsNotExist(err) {
+		return settings, err
+	}
+
+	return settings, nil
+}
+
+// settingsPath returns the location of the settings file
+func settingsPath() (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "settings.json"), nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/png"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// splashDir holds the screens the device shows while asleep, off or starting
+const splashDir = "/usr/share/remarkable"
+
+// splashBackupDir keeps the original of every replaced screen
+const splashBackupDir = "/usr/share/remarkable/splash_originals"
+
+// splashScreens are the screens that can be replaced
+var splashScreens = []string{
+	"suspended.png",
+	"poweroff.png",
+	"starting.png",
+	"rebooting.png",
+	"batteryempty.png",
+	"overheating.png",
+	"restart-crashed.png",
+}
+
+// ListSplashScreens returns the splash screens on the device with their images
+func (a *App) ListSplashScreens() ([]SplashScreen, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	customized, err := a.listSplashBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	screens := []SplashScreen{}
+	for _, name := range splashScreens {
+		data, err := a.runCommand("Splash", fmt.Sprintf("[ ! -f %s ] || cat %s", shellQuote(path.Join(splashDir, name)), shellQuote(path.Join(splashDir, name))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		screen := SplashScreen{
+			Name:       name,
+			Size:       int64(len(data)),
+			Customized: customized[name],
+			Image:      data,
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			screen.Width, screen.Height = config.Width, config.Height
+		}
+		screens = append(screens, screen)
+	}
+
+	return screens, nil
+}
+
+// SelectSplashFile opens a native file dialog to select a PNG splash screen
+func (a *App) SelectSplashFile() (*SelectedFile, error) {
+	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Splash Screen",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "PNG Images (*.png)", Pattern: "*.png"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file dialog: %w", err)
+	}
+	if selection == "" {
+		return nil, nil
+	}
+
+	return &SelectedFile{
+		Name: filepath.Base(selection),
+		Path: selection,
+	}, nil
+}
+
+// ReplaceSplashScreen uploads a PNG as the given splash screen. The image must
+// have the same size as the device's screen. The original is backed up on
+// the device the first time a screen is replaced, see RestoreSplashScreen.
+func (a *App) ReplaceSplashScreen(name string, localPath string) (*SyncResult, error) {
+	log.Printf("[Splash] Replacing %s with %s...", name, localPath)
+
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+	if !slices.Contains(splashScreens, name) {
+		return nil, fmt.Errorf("unknown splash screen %q", name)
+	}
+
+	width, height, err := a.splashSize(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "png" {
+		return nil, fmt.Errorf("%s is not a PNG image", localPath)
+	}
+	if config.Width != width || config.Height != height {
+		return nil, fmt.Errorf("the image is %dx%d but the screen is %dx%d pixels", config.Width, config.Height, width, height)
+	}
+
+	remotePath := path.Join(splashDir, name)
+	var result *SyncResult
+	err = a.withWritableRoot("Splash", func() error {
+		// Keep the first original only, later replacements overwrite custom screens
+		backupPath := path.Join(splashBackupDir, name)
+		cmd := fmt.Sprintf("mkdir -p %s && { [ -f %s ] || [ ! -f %s ] || cp -p %s %s; }",
+			shellQuote(splashBackupDir), shellQuote(backupPath), shellQuote(remotePath), shellQuote(remotePath), shellQuote(backupPath))
+		if _, err := a.runCommand("Splash", cmd); err != nil {
+			return fmt.Errorf("failed to back up the original %s: %w", name, err)
+		}
+
+		txn := a.beginTransaction("Splash")
+		if err := txn.snapshot(remotePath); err != nil {
+			return err
+		}
+		var err error
+		result, err = txn.finish(nil, a.uploadSplashScreen(localPath, remotePath, int64(len(data))))
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("[Splash] SUCCESS: %s replaced", name)
+	return result, nil
+}
+
+// RestoreSplashScreen puts back the original of a replaced splash screen
+func (a *App) RestoreSplashScreen(name string) error {
+	log.Printf("[Splash] Restoring the original %s...", name)
+
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+	if !slices.Contains(splashScreens, name) {
+		return fmt.Errorf("unknown splash screen %q", name)
+	}
+
+	customized, err := a.listSplashBackups()
+	if err != nil {
+		return err
+	}
+	if !customized[name] {
+		return fmt.Errorf("%s has not been replaced", name)
+	}
+
+	backupPath := path.Join(splashBackupDir, name)
+	remotePath := path.Join(splashDir, name)
+	err = a.withWritableRoot("Splash", func() error {
+		cmd := fmt.Sprintf("cp -p %s %s && rm %s", shellQuote(backupPath), shellQuote(remotePath), shellQuote(backupPath))
+		_, err := a.runCommand("Splash", cmd)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+
+	log.Printf("[Splash] SUCCESS: %s restored", name)
+	return nil
+}
+
+// uploadSplashScreen uploads the image and checks that it arrived completely
+func (a *App) uploadSplashScreen(localPath, remotePath string, size int64) error {
+	if err := a.uploadFile(localPath, remotePath); err != nil {
+		return err
+	}
+
+	output, err := a.runCommand("Splash", "stat -c %s "+shellQuote(remotePath))
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if strings.TrimSpace(string(output)) != fmt.Sprint(size) {
+		return fmt.Errorf("verification failed: %s was not uploaded completely", path.Base(remotePath))
+	}
+
+	return nil
+}
+
+// splashSize returns the size a replacement for the given screen must have:
+// the device's screen size, or the current image's size on unknown models
+func (a *App) splashSize(name string) (int, int, error) {
+	info, err := a.deviceInfo("Splash")
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.ScreenWidth > 0 {
+		return info.ScreenWidth, info.ScreenHeight, nil
+	}
+
+	data, err := a.runCommand("Splash", "cat "+shellQuote(path.Join(splashDir, name)))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read the size of %s: %w", name, err)
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// listSplashBackups returns the set of screens whose original is backed up
+func (a *App) listSplashBackups() (map[string]bool, error) {
+	output, err := a.runCommand("Splash", fmt.Sprintf("[ ! -d %s ] || ls -1 %s", shellQuote(splashBackupDir), shellQuote(splashBackupDir)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list splash screen backups: %w", err)
+	}
+
+	backups := make(map[string]bool)
+	for _, name := range strings.Split(string(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			backups[name] = true
+		}
+	}
+
+	return backups, nil
+}
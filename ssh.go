@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -88,71 +91,147 @@ func expandPath(path string) (string, error) {
 
 // ConnectSSH establishes an SSH connection to the device using the specified key
 func (a *App) ConnectSSH(keyPath string, ip string) error {
+	auth, err := keyAuth(keyPath)
+	if err != nil {
+		return err
+	}
+
+	if err := a.connect("ConnectSSH", ip, auth, keyPath); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	return nil
+}
+
+// keyAuth authenticates with the private key at keyPath
+func keyAuth(keyPath string) ([]ssh.AuthMethod, error) {
 	// Expand the key path
 	expandedPath, err := expandPath(keyPath)
 	if err != nil {
-		return fmt.Errorf("failed to expand key path: %w", err)
+		return nil, fmt.Errorf("failed to expand key path: %w", err)
 	}
 
 	// Read the private key
 	keyData, err := os.ReadFile(expandedPath)
 	if err != nil {
-		return fmt.Errorf("failed to read private key: %w", err)
+		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
 
 	// Parse the private key
 	signer, err := ssh.ParsePrivateKey(keyData)
 	if err != nil {
-		return fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	// Configure SSH client
-	config := &ssh.ClientConfig{
-		User: "root",
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // For reMarkable device
-		Timeout:         10 * time.Second,
+	return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+}
+
+// ConnectWithPassword establishes an SSH connection to the device using its
+// root password, for machines where no SSH key can be stored. The password
+// is kept in memory only, to reconnect after a reboot, and is dropped on
+// disconnect. Firmware that asks for keyboard-interactive authentication is
+// supported too.
+func (a *App) ConnectWithPassword(ip string, password string) error {
+	if err := a.connect("ConnectWithPassword", ip, passwordAuth(password), ""); err != nil {
+		return fmt.Errorf("failed to connect with password: %w", err)
 	}
+	return nil
+}
 
-	// Connect to the device
-	address := net.JoinHostPort(ip, "22")
-	client, err := ssh.Dial("tcp", address, config)
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+// Reconnect connects again with the parameters of the last connection, after
+// the connection was lost
+func (a *App) Reconnect() error {
+	if a.auth == nil {
+		return fmt.Errorf("not connected to reMarkable device")
 	}
+	return a.connect("Reconnect", a.ip, a.auth, a.keyPath)
+}
 
-	// Store the client for later use
-	a.sshClient = client
+// connect dials the device and makes the connection the current one. keyPath
+// is the key behind auth, or empty for password connections. It refuses to
+// replace a connection while an operation has the root filesystem remounted,
+// as the mount state kept for that connection would be lost.
+func (a *App) connect(op, ip string, auth []ssh.AuthMethod, keyPath string) error {
+	if a.changingDevice() {
+		return fmt.Errorf("cannot connect while another operation is changing the device")
+	}
 
-	// Remount root filesystem as read-write to ensure write access
-	log.Println("[ConnectSSH] Remounting root filesystem as read-write...")
-	session, err := client.NewSession()
+	client, err := dialDevice(ip, auth)
 	if err != nil {
-		log.Printf("[ConnectSSH] WARNING: Failed to create session for remount: %v", err)
-		// Don't fail the connection if remount fails, but log it
-		return nil
+		return err
 	}
-	defer session.Close()
 
-	remountOutput, err := session.CombinedOutput("mount -o remount,rw /")
+	// Replace any previous connection; the device may have changed since then
+	if a.sshClient != nil {
+		a.sshClient.Close()
+	}
+	a.sshClient = client
+	a.resetDeviceState()
+
+	// Record the original mount mode, the root filesystem is only made
+	// writable around operations that change it, see withWritableRoot
+	mode, err := a.readRootMountMode(op)
 	if err != nil {
-		log.Printf("[ConnectSSH] WARNING: Failed to remount filesystem: %v, output: %s", err, string(remountOutput))
-		// Don't fail the connection if remount fails, but log it
-	} else {
-		log.Printf("[ConnectSSH] Filesystem remounted successfully, output: %s", string(remountOutput))
+		// Assuming read-only means every change is followed by a remount to read-only
+		log.Printf("[%s] WARNING: %v, assuming read-only", op, err)
+		mode = mountReadOnly
+	}
+	a.mountMu.Lock()
+	a.rootMountMode = mode
+	a.writableDepth = 0
+	a.mountMu.Unlock()
+	log.Printf("[%s] Root filesystem is mounted %s", op, mode)
+
+	// Firmware updates remove the unit of the template restore hook
+	if err := a.repairPersistence(op); err != nil {
+		log.Printf("[%s] WARNING: Failed to repair the template restore hook: %v", op, err)
 	}
 
+	// Only a fully set up connection is reconnected to later
+	a.keyPath, a.ip, a.auth = keyPath, ip, auth
 	return nil
 }
 
+// dialDevice opens an SSH connection to the device as root
+func dialDevice(ip string, auth []ssh.AuthMethod) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            "root",
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // For reMarkable device
+		Timeout:         10 * time.Second,
+	}
+
+	return ssh.Dial("tcp", net.JoinHostPort(ip, "22"), config)
+}
+
+// passwordAuth authenticates with the root password, answering
+// keyboard-interactive prompts with it for firmware that requires them
+func passwordAuth(password string) []ssh.AuthMethod {
+	return []ssh.AuthMethod{
+		ssh.Password(password),
+		ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		}),
+	}
+}
+
 // DisconnectSSH closes the SSH connection
 func (a *App) DisconnectSSH() error {
 	if a.sshClient != nil {
+		// Leave the device as read-only as it was found
+		remountErr := a.restoreRootMountMode("DisconnectSSH")
+		if remountErr != nil {
+			log.Printf("[DisconnectSSH] ERROR: %v", remountErr)
+		}
 		err := a.sshClient.Close()
 		a.sshClient = nil
-		return err
+		// Drop the credentials, including any password, with the connection
+		a.keyPath, a.auth = "", nil
+		a.resetDeviceState()
+		return errors.Join(remountErr, err)
 	}
 	return nil
 }
@@ -168,6 +247,7 @@ func (a *App) CheckConnection() error {
 		return fmt.Errorf("not connected")
 	}
 
+	// Not recorded in the operation log, the frontend polls this every few seconds
 	session, err := a.sshClient.NewSession()
 	if err != nil {
 		return fmt.Errorf("connection lost: %w", err)
@@ -181,6 +261,127 @@ func (a *App) CheckConnection() error {
 	return nil
 }
 
+// runCommand runs a command on the device and returns its standard output.
+// The op label is used to tag log messages with the calling operation.
+func (a *App) runCommand(op, cmd string) ([]byte, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	session, err := a.sshClient.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	start := time.Now()
+	output, err := session.Output(cmd)
+	a.recordCommand(op, cmd, start, 0, int64(len(output)), err)
+	if err != nil {
+		log.Printf("[%s] Command failed: %s: %v, stderr: %s", op, cmd, err, strings.TrimSpace(stderr.String()))
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return output, fmt.Errorf("%w: %s", err, msg)
+		}
+		return output, err
+	}
+
+	return output, nil
+}
+
+// runCommandWithInput runs a command on the device, writing input to its stdin
+func (a *App) runCommandWithInput(op, cmd string, input []byte) error {
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+
+	session, err := a.sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(input)
+	start := time.Now()
+	output, err := session.CombinedOutput(cmd)
+	a.recordCommand(op, cmd, start, int64(len(input)), int64(len(output)), err)
+	if err != nil {
+		log.Printf("[%s] Command failed: %s: %v, output: %s", op, cmd, err, strings.TrimSpace(string(output)))
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// streamCommand runs a command on the device and passes its standard output
+// to consume as a stream, for outputs too large to hold in memory
+func (a *App) streamCommand(op, cmd string, consume func(io.Reader) error) error {
+	if a.sshClient == nil {
+		return fmt.Errorf("not connected to reMarkable device")
+	}
+
+	session, err := a.sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	start := time.Now()
+	if err := session.Start(cmd); err != nil {
+		a.recordCommand(op, cmd, start, 0, 0, err)
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	counter := &countingReader{r: stdout}
+	consumeErr := consume(counter)
+	if consumeErr != nil {
+		// Unblock the remote command if we stopped reading early
+		io.Copy(io.Discard, counter)
+	}
+
+	err = session.Wait()
+	a.recordCommand(op, cmd, start, 0, counter.n, err)
+	if err != nil {
+		log.Printf("[%s] Command failed: %s: %v, stderr: %s", op, cmd, err, strings.TrimSpace(stderr.String()))
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	return consumeErr
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// shellQuote quotes s for safe use as a single argument in a remote shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // generateRandomID generates a random ID for the key name
 func generateRandomID() string {
 	b := make([]byte, 8)
@@ -264,20 +465,13 @@ func (a *App) UploadSSHKey(keyPath string, ip string, password string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read public key: %w", err)
 	}
-	publicKeyContent := strings.TrimSpace(string(publicKeyData))
-
-	// Connect with password authentication
-	passwordConfig := &ssh.ClientConfig{
-		User: "root",
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+	cmd, err := authorizeKeyCommand(publicKeyData)
+	if err != nil {
+		return err
 	}
 
-	address := net.JoinHostPort(ip, "22")
-	passwordClient, err := ssh.Dial("tcp", address, passwordConfig)
+	// Connect with password authentication
+	passwordClient, err := dialDevice(ip, passwordAuth(password))
 	if err != nil {
 		return fmt.Errorf("failed to connect with password: %w", err)
 	}
@@ -290,13 +484,16 @@ func (a *App) UploadSSHKey(keyPath string, ip string, password string) error {
 	}
 	defer session.Close()
 
-	// Command to create .ssh directory and append the public key to authorized_keys
-	// Using single quotes around the key to prevent shell interpretation
-	cmd := fmt.Sprintf(`mkdir -p ~/.ssh && echo '%s' >> ~/.ssh/authorized_keys && chmod 700 ~/.ssh && chmod 600 ~/.ssh/authorized_keys`, publicKeyContent)
-
-	if err := session.Run(cmd); err != nil {
+	// Append the public key to authorized_keys unless it is already there
+	start := time.Now()
+	output, err := session.Output(cmd)
+	a.recordCommand("UploadSSHKey", cmd, start, 0, int64(len(output)), err)
+	if err != nil {
 		return fmt.Errorf("failed to upload key to device: %w", err)
 	}
+	if strings.TrimSpace(string(output)) == "present" {
+		log.Println("[UploadSSHKey] Key is already authorized on the device")
+	}
 
 	// Close password connection
 	passwordClient.Close()
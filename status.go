@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// usbNetworkAddress is the device's address on the USB network interface
+const usbNetworkAddress = "10.11.99.1"
+
+// Connection types reported in DeviceStatus
+const (
+	ConnectionUSB  = "usb"
+	ConnectionWiFi = "wifi"
+)
+
+// deviceStatusCommand prints the battery, uptime, storage, root mount mode
+// and SSH connection of the device as key=value lines, see parseDeviceStatus
+const deviceStatusCommand = `for d in /sys/class/power_supply/*; do
+	[ "$(cat "$d/type" 2>/dev/null)" = Battery ] || continue
+	echo "capacity=$(cat "$d/capacity" 2>/dev/null)"
+	echo "battery=$(cat "$d/status" 2>/dev/null)"
+	break
+done
+echo "uptime=$(cut -d' ' -f1 /proc/uptime)"
+df -Pk / /home 2>/dev/null | tail -n +2 | while read fs size used avail capacity mount; do echo "df=$mount $size $used $avail"; done
+echo "mount=$(awk '$2 == "/" { print $4 }' /proc/mounts | tail -n 1)"
+echo "ssh=$SSH_CONNECTION"`
+
+// GetDeviceStatus returns the battery level, storage, uptime, connection
+// type and root mount mode of the connected device
+func (a *App) GetDeviceStatus() (*DeviceStatus, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	output, err := a.runCommand("DeviceStatus", deviceStatusCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device status: %w", err)
+	}
+
+	return parseDeviceStatus(string(output)), nil
+}
+
+// parseDeviceStatus parses the output of deviceStatusCommand
+func parseDeviceStatus(output string) *DeviceStatus {
+	status := &DeviceStatus{BatteryLevel: -1}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "capacity":
+			if level, err := strconv.Atoi(value); err == nil {
+				status.BatteryLevel = level
+			}
+		case "battery":
+			status.BatteryStatus = value
+			status.Charging = value == "Charging" || value == "Full"
+		case "uptime":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				status.Uptime = int64(seconds)
+			}
+		case "df":
+			// <mount point> <size> <used> <available>, in KiB
+			fields := strings.Fields(value)
+			if len(fields) != 4 {
+				continue
+			}
+			var usage DiskUsage
+			usage.Total, _ = strconv.ParseInt(fields[1], 10, 64)
+			usage.Used, _ = strconv.ParseInt(fields[2], 10, 64)
+			usage.Free, _ = strconv.ParseInt(fields[3], 10, 64)
+			usage.Total, usage.Used, usage.Free = usage.Total*1024, usage.Used*1024, usage.Free*1024
+			switch fields[0] {
+			case "/":
+				status.Root = usage
+			case "/home":
+				status.Home = usage
+			}
+		case "mount":
+			status.MountMode, _, _ = strings.Cut(value, ",")
+		case "ssh":
+			// <client address> <client port> <server address> <server port>
+			fields := strings.Fields(value)
+			if len(fields) == 4 {
+				status.Connection = ConnectionWiFi
+				if fields[2] == usbNetworkAddress {
+					status.Connection = ConnectionUSB
+				}
+			}
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stockManifest is the list of built-in templates recorded for one firmware
+// version of one device
+type stockManifest struct {
+	Serial    string    `json:"serial"`
+	Firmware  string    `json:"firmware"`
+	CreatedAt time.Time `json:"createdAt"`
+	Filenames []string  `json:"filenames"`
+}
+
+// unsafeFileChars matches characters that are not allowed in local file names
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// firmwareImageSlack is how far from /etc/version the time of a file of the
+// firmware image may be, as the image's files are not all written at once
+const firmwareImageSlack = time.Hour
+
+// stockTemplates returns the filenames of the device's built-in templates.
+// reMarkable does not mark its own templates, so the first time the app sees
+// a firmware version on a device it records them, and from then on the
+// recorded list is used. Firmware updates replace the templates directory, so
+// every new firmware version starts from a clean set. If they can't be
+// identified no template is protected, rather than blocking every change.
+func (a *App) stockTemplates(op string) map[string]bool {
+	a.stockMu.Lock()
+	defer a.stockMu.Unlock()
+
+	if a.stock != nil {
+		return a.stock
+	}
+
+	filenames, err := a.loadStockManifest(op)
+	if err != nil {
+		// Not cached, so the next operation tries again
+		log.Printf("[%s] WARNING: Failed to identify stock templates, none are protected: %v", op, err)
+		return map[string]bool{}
+	}
+
+	a.stock = make(map[string]bool)
+	for _, filename := range filenames {
+		a.stock[filename] = true
+	}
+
+	return a.stock
+}
+
+// loadStockManifest returns the built-in templates recorded for the device's
+// firmware, seeding the record on the first connection with that firmware
+func (a *App) loadStockManifest(op string) ([]string, error) {
+	firmware, err := a.readFirmwareVersion(op)
+	if err != nil {
+		return nil, err
+	}
+	serial := a.readDeviceSerial(op)
+
+	dir, err := appDataDir("stock", unsafeFileChars.ReplaceAllString(serial, "_"))
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(dir, unsafeFileChars.ReplaceAllString(firmware, "_")+".json")
+
+	var manifest stockManifest
+	err = readJSONFile(manifestPath, &manifest)
+	if err == nil {
+		return manifest.Filenames, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		// Seeding again could protect the wrong templates, keep the record for the user to fix
+		return nil, fmt.Errorf("failed to read %s: %w", manifestPath, err)
+	}
+
+	// First connection with this firmware: find the built-in templates
+	manifest = stockManifest{Serial: serial, Firmware: firmware, CreatedAt: time.Now()}
+	manifest.Filenames, err = a.findStockTemplates(op)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Filenames) == 0 {
+		return nil, fmt.Errorf("no template files came with firmware %s", firmware)
+	}
+
+	// Without a serial the manifest can't be told apart from other devices' ones
+	if serial != "unknown" {
+		if err := writeJSONFile(manifestPath, manifest); err != nil {
+			return nil, fmt.Errorf("failed to save stock templates: %w", err)
+		}
+	}
+	log.Printf("[%s] Recorded %d stock templates for firmware %s", op, len(manifest.Filenames), firmware)
+
+	return manifest.Filenames, nil
+}
+
+// findStockTemplates returns the filenames of the templates.json entries
+// whose image files came with the firmware image, leaving out the templates
+// this app recorded as installed
+func (a *App) findStockTemplates(op string) ([]string, error) {
+	_, data, err := a.readTemplatesJSON(op)
+	if err != nil {
+		return nil, err
+	}
+	imageFiles, err := a.firmwareImageFiles(op)
+	if err != nil {
+		return nil, err
+	}
+	_, record, err := a.loadInstalledRecord(op)
+	if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	for _, entry := range data.Templates {
+		if indexOfInstalledTemplate(record.Templates, entry.Filename) >= 0 {
+			continue
+		}
+		for _, ext := range templateImageExts {
+			if imageFiles[entry.Filename+ext] {
+				filenames = append(filenames, entry.Filename)
+				break
+			}
+		}
+	}
+
+	return filenames, nil
+}
+
+// firmwareImageFiles returns the files of the templates directory that came
+// with the firmware image. The image's files keep the time of the firmware
+// build, like /etc/version, while files written on the device later get the
+// time they were written and copies made elsewhere usually keep an older one.
+func (a *App) firmwareImageFiles(op string) (map[string]bool, error) {
+	cmd := fmt.Sprintf(`stat -c '%%Y' /etc/version && cd %s && if [ -n "$(ls)" ]; then stat -c '%%Y %%n' -- *; fi`, shellQuote(templatesDir))
+	output, err := a.runCommand(op, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file times: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	built, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the firmware build time: %w", err)
+	}
+	slack := int64(firmwareImageSlack / time.Second)
+
+	files := make(map[string]bool)
+	for _, line := range lines[1:] {
+		mtime, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(mtime, 10, 64)
+		if err == nil && seconds >= built-slack && seconds <= built+slack {
+			files[name] = true
+		}
+	}
+
+	return files, nil
+}
+
+// markStockTemplates sets the Stock flag on the built-in entries
+func (a *App) markStockTemplates(op string, entries []DeviceTemplate) {
+	stock := a.stockTemplates(op)
+	for i := range entries {
+		entries[i].Stock = stock[entries[i].Filename]
+	}
+}
+
+// stockChanges returns the built-in templates a plan would delete, modify or overwrite
+func (a *App) stockChanges(op string, plan *SyncPlan) []string {
+	stock := a.stockTemplates(op)
+
+	changed := make(map[string]bool)
+	for _, entry := range plan.Removed {
+		if stock[entry.Filename] {
+			changed[entry.Filename] = true
+		}
+	}
+	for _, change := range plan.Changed {
+		if stock[change.Before.Filename] {
+			changed[change.Before.Filename] = true
+		}
+	}
+	for _, upload := range plan.Uploads {
+		if stock[upload.Filename] {
+			changed[upload.Filename] = true
+		}
+	}
+
+	filenames := make([]string, 0, len(changed))
+	for filename := range changed {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	return filenames
+}
+
+// checkStockChanges refuses plans that touch built-in templates unless the override is set
+func (a *App) checkStockChanges(op string, plan *SyncPlan, allow bool) error {
+	filenames := a.stockChanges(op, plan)
+	if len(filenames) > 0 && !allow {
+		return fmt.Errorf("refusing to modify built-in templates without override: %s", strings.Join(filenames, ", "))
+	}
+
+	return nil
+}
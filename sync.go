@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// templateImageExts are the image files the device may keep for a single template
+var templateImageExts = []string{".png", ".svg"}
+
+// PlanSync computes what SyncTemplates would do for the given templates,
+// deletions and options, without making any changes on the device
+func (a *App) PlanSync(templates []SyncTemplate, deletions []string, options SyncOptions) (*SyncPlan, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+
+	before, data, err := a.readTemplatesJSON("PlanSync")
+	if err != nil {
+		return nil, err
+	}
+
+	existingFiles, err := a.listTemplateFiles("PlanSync")
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{
+		Uploads:       []PlannedUpload{},
+		Deletions:     []string{},
+		Added:         []DeviceTemplate{},
+		Removed:       []DeviceTemplate{},
+		Changed:       []TemplateChange{},
+		KeptFiles:     []string{},
+		UserTemplates: []PlannedUserTemplate{},
+		UserDeletions: []string{},
+		Revision:      templatesRevision(before),
+		Before:        string(before),
+	}
+
+	// The backend takes what it stores outside templates.json, such as user
+	// templates, everything else goes through templates.json
+	templates, deletions, err = a.templateBackend("PlanSync").plan(plan, templates, deletions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files to upload
+	for _, tmpl := range templates {
+		digest, err := localFileDigest(tmpl.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", tmpl.Filename, err)
+		}
+
+		fileName := filepath.Base(tmpl.LocalPath)
+		plan.Uploads = append(plan.Uploads, PlannedUpload{
+			Filename:   tmpl.Filename,
+			LocalPath:  tmpl.LocalPath,
+			RemotePath: path.Join(templatesDir, fileName),
+			Size:       digest.Size,
+			SHA256:     digest.SHA256,
+			Overwrite:  existingFiles[fileName],
+		})
+	}
+
+	// Remove deleted template entries
+	deletionSet := make(map[string]bool)
+	for _, filename := range deletions {
+		deletionSet[filename] = true
+	}
+	entries := []DeviceTemplate{}
+	for _, entry := range data.Templates {
+		if deletionSet[entry.Filename] {
+			plan.Removed = append(plan.Removed, entry)
+			for _, ext := range templateImageExts {
+				if existingFiles[entry.Filename+ext] {
+					plan.KeptFiles = append(plan.KeptFiles, path.Join(templatesDir, entry.Filename+ext))
+				}
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// Add new template entries, updating the name of any that already exist
+	for _, tmpl := range templates {
+		if i := indexOfTemplate(entries, tmpl.Filename); i >= 0 {
+			if entries[i].Name != tmpl.Name {
+				updated := entries[i]
+				updated.Name = tmpl.Name
+				plan.Changed = append(plan.Changed, TemplateChange{Before: entries[i], After: updated})
+				entries[i] = updated
+			}
+			continue
+		}
+
+		entry := newTemplateEntry(tmpl)
+		plan.Added = append(plan.Added, entry)
+		entries = append(entries, entry)
+	}
+
+	// Apply the requested order
+	if len(options.Order) > 0 {
+		ordered := orderTemplates(entries, options.Order)
+		for i := range entries {
+			if entries[i].Filename != ordered[i].Filename {
+				plan.Reordered = true
+				break
+			}
+		}
+		entries = ordered
+	}
+
+	// Deleting a template only removes its entry, its image files stay on the
+	// device and are listed in KeptFiles
+	plan.After, err = updatedTemplatesJSON(before, data, entries)
+	if err != nil {
+		return nil, err
+	}
+	plan.Diff = templatesJSONDiff(plan.Before, plan.After)
+
+	plan.StockChanges = a.stockChanges("PlanSync", plan)
+
+	return plan, nil
+}
+
+// localFileDigest returns the size and SHA-256 hash of a local file
+func localFileDigest(localPath string) (fileDigest, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	return fileDigest{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// ApplySyncPlan applies a plan returned by PlanSync as a transaction. It
+// refuses to run if the device's templates.json or any of the local files
+// changed since the plan was made, or if the uploads would not fit on the
+// device, and rolls back every change if a step or the final verification
+// fails. Plans touching built-in templates are refused unless
+// options.AllowStockChanges is set. With options.Snapshot the original files
+// are also saved to the local sync history, see UndoSync.
+func (a *App) ApplySyncPlan(plan *SyncPlan, options SyncOptions) (*SyncResult, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("no sync plan given")
+	}
+
+	// Make sure the plan still describes the current state
+	current, _, err := a.readTemplatesJSON("ApplySyncPlan")
+	if err != nil {
+		return nil, err
+	}
+	if templatesRevision(current) != plan.Revision {
+		return nil, fmt.Errorf("templates.json changed on the device since the sync was planned")
+	}
+	if err := a.checkStockChanges("ApplySyncPlan", plan, options.AllowStockChanges); err != nil {
+		return nil, err
+	}
+	for _, upload := range plan.Uploads {
+		digest, err := localFileDigest(upload.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", upload.Filename, err)
+		}
+		if digest != (fileDigest{Size: upload.Size, SHA256: upload.SHA256}) {
+			return nil, fmt.Errorf("%s changed since the sync was planned", upload.LocalPath)
+		}
+	}
+	for _, tmpl := range plan.UserTemplates {
+		digest, err := localFileDigest(tmpl.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", tmpl.Name, err)
+		}
+		if digest != (fileDigest{Size: tmpl.Size, SHA256: tmpl.SHA256}) {
+			return nil, fmt.Errorf("%s changed since the sync was planned", tmpl.LocalPath)
+		}
+	}
+
+	if err := a.checkSyncSpace(plan); err != nil {
+		return nil, err
+	}
+	backend := a.templateBackend("ApplySyncPlan")
+
+	// Snapshot everything the plan touches before changing anything
+	txn := a.beginTransaction("ApplySyncPlan")
+	if err := txn.snapshot(templatesJSONPath); err != nil {
+		return nil, err
+	}
+	for _, upload := range plan.Uploads {
+		if err := txn.snapshot(upload.RemotePath); err != nil {
+			return nil, err
+		}
+	}
+	for _, remotePath := range plan.Deletions {
+		if err := txn.snapshot(remotePath); err != nil {
+			return nil, err
+		}
+	}
+	for _, tmpl := range plan.UserTemplates {
+		for _, remotePath := range userTemplatePaths(tmpl.ID) {
+			if err := txn.snapshot(remotePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, id := range plan.UserDeletions {
+		for _, remotePath := range userTemplatePaths(id) {
+			if err := txn.snapshot(remotePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Keep a copy of the snapshot in the local history so the sync can be undone
+	var snapshot *SyncSnapshot
+	if options.Snapshot {
+		snapshot, err = a.saveSyncSnapshot(txn, plan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take pre-sync snapshot: %w", err)
+		}
+	}
+
+	var result *SyncResult
+	err = a.withWritableRoot("ApplySyncPlan", func() error {
+		var err error
+		result, err = txn.finish(plan, a.applySyncPlan(plan, backend))
+		return err
+	})
+	if result == nil {
+		// The root filesystem could not be made writable, nothing was changed
+		if snapshot != nil {
+			discardSyncSnapshot(snapshot.ID)
+		}
+		return nil, err
+	}
+	if result.Status == SyncCommitted {
+		// Remember the custom templates so they can be reinstalled after a firmware update
+		if err := a.recordInstalledTemplates("ApplySyncPlan", plan); err != nil {
+			log.Printf("[ApplySyncPlan] WARNING: Failed to record installed templates: %v", err)
+		}
+		if err := a.refreshPersistentTemplates("ApplySyncPlan"); err != nil {
+			log.Printf("[ApplySyncPlan] WARNING: Failed to update stored templates: %v", err)
+		}
+	}
+	if snapshot != nil {
+		if result.Status == SyncCommitted {
+			result.Snapshot = snapshot.ID
+		} else {
+			discardSyncSnapshot(snapshot.ID)
+		}
+	}
+
+	return result, err
+}
+
+// applySyncPlan performs the steps of a plan and verifies the outcome
+func (a *App) applySyncPlan(plan *SyncPlan, backend templateBackend) error {
+	// Step 1: Upload each template file
+	for _, upload := range plan.Uploads {
+		if err := a.uploadFile(upload.LocalPath, upload.RemotePath); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", upload.Filename, err)
+		}
+	}
+
+	// Step 2: Delete the files of removed templates
+	if len(plan.Deletions) > 0 {
+		quoted := make([]string, len(plan.Deletions))
+		for i, remotePath := range plan.Deletions {
+			quoted[i] = shellQuote(remotePath)
+		}
+		if _, err := a.runCommand("ApplySyncPlan", "rm -f "+strings.Join(quoted, " ")); err != nil {
+			return fmt.Errorf("failed to delete template files: %w", err)
+		}
+	}
+
+	// Step 3: Write the updated templates.json
+	if plan.After != plan.Before {
+		if err := a.runCommandWithInput("ApplySyncPlan", "cat > "+shellQuote(templatesJSONPath), []byte(plan.After)); err != nil {
+			return fmt.Errorf("failed to write templates.json: %w", err)
+		}
+	}
+
+	// Step 4: Make the backend's changes, such as adding and deleting user templates
+	if err := backend.apply(plan); err != nil {
+		return err
+	}
+
+	// Step 5: Verify the device now matches the plan
+	if err := a.verifySyncPlan(plan); err != nil {
+		return err
+	}
+	return backend.verify(plan)
+}
+
+// verifySyncPlan checks that templates.json, the uploaded files and the
+// deleted files on the device match the plan
+func (a *App) verifySyncPlan(plan *SyncPlan) error {
+	written, _, err := a.readTemplatesJSON("ApplySyncPlan")
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if string(written) != plan.After {
+		return fmt.Errorf("verification failed: templates.json does not match the planned content")
+	}
+
+	files, err := a.listTemplateFiles("ApplySyncPlan")
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	for _, remotePath := range plan.Deletions {
+		if files[path.Base(remotePath)] {
+			return fmt.Errorf("verification failed: %s was not deleted", remotePath)
+		}
+	}
+
+	if len(plan.Uploads) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(plan.Uploads))
+	for i, upload := range plan.Uploads {
+		quoted[i] = shellQuote(upload.RemotePath)
+	}
+	output, err := a.runCommand("ApplySyncPlan", "stat -c %s "+strings.Join(quoted, " "))
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	sizes := strings.Fields(string(output))
+	for i, upload := range plan.Uploads {
+		if i >= len(sizes) || sizes[i] != strconv.FormatInt(upload.Size, 10) {
+			return fmt.Errorf("verification failed: %s was not uploaded completely", upload.Filename)
+		}
+	}
+
+	return nil
+}
+
+// checkMergeConflicts does the conflict check of a three-way merge between the
+// templates.json revision the user's changes were made against, the current
+// revision in the plan, and the user's changes. The plan itself already applies
+// the changes on top of the current revision.
+func (a *App) checkMergeConflicts(baseRevision string, plan *SyncPlan, templates []SyncTemplate, deletions []string) error {
+	a.fetchedRevisionsMu.Lock()
+	baseContent, ok := a.fetchedRevisions[baseRevision]
+	a.fetchedRevisionsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("templates.json was changed on the device and the loaded revision is unknown, reload the templates and try again")
+	}
+
+	var base, current templatesJSON
+	if err := json.Unmarshal(baseContent, &base); err != nil {
+		return fmt.Errorf("failed to parse templates.json: %w", err)
+	}
+	if err := json.Unmarshal([]byte(plan.Before), &current); err != nil {
+		return fmt.Errorf("failed to parse templates.json: %w", err)
+	}
+
+	// User templates are not in templates.json and never conflict
+	var legacyTemplates []SyncTemplate
+	for _, tmpl := range templates {
+		if !isUserTemplateFile(tmpl.LocalPath) {
+			legacyTemplates = append(legacyTemplates, tmpl)
+		}
+	}
+	var legacyDeletions []string
+	for _, filename := range deletions {
+		if !slices.Contains(plan.UserDeletions, filename) {
+			legacyDeletions = append(legacyDeletions, filename)
+		}
+	}
+
+	conflicts := mergeConflicts(base.Templates, current.Templates, legacyTemplates, legacyDeletions)
+	if len(conflicts) > 0 {
+		return fmt.Errorf("templates.json was changed on the device and the changes conflict for: %s", strings.Join(conflicts, ", "))
+	}
+
+	return nil
+}
+
+// mergeConflicts returns the filenames of the templates uploaded or deleted
+// that were also added, modified or removed in templates.json between the
+// base and the current entries
+func mergeConflicts(base, current []DeviceTemplate, templates []SyncTemplate, deletions []string) []string {
+	// changedRemotely reports whether the entry for filename was added,
+	// modified or removed on the device since the base revision
+	changedRemotely := func(filename string) bool {
+		baseIndex := indexOfTemplate(base, filename)
+		currentIndex := indexOfTemplate(current, filename)
+		if baseIndex < 0 || currentIndex < 0 {
+			return baseIndex != currentIndex
+		}
+		return !reflect.DeepEqual(base[baseIndex], current[currentIndex])
+	}
+
+	var conflicts []string
+	for _, tmpl := range templates {
+		if changedRemotely(tmpl.Filename) {
+			conflicts = append(conflicts, tmpl.Filename)
+		}
+	}
+	for _, filename := range deletions {
+		// A template deleted on both sides is not a conflict
+		if changedRemotely(filename) && indexOfTemplate(current, filename) >= 0 {
+			conflicts = append(conflicts, filename)
+		}
+	}
+
+	return conflicts
+}
+
+// newTemplateEntry returns the templates.json entry for a newly uploaded template
+func newTemplateEntry(tmpl SyncTemplate) DeviceTemplate {
+	return DeviceTemplate{
+		Name:       tmpl.Name,
+		Filename:   tmpl.Filename,
+		IconCode:   "\ue9fe",
+		Categories: []string{"Creative", "Lines", "Grids", "Planners"},
+	}
+}
+
+// indexOfTemplate returns the index of the entry with the given filename, or -1
+func indexOfTemplate(entries []DeviceTemplate, filename string) int {
+	for i, entry := range entries {
+		if entry.Filename == filename {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexOfTemplate(t *testing.T) {
+	entries := []DeviceTemplate{
+		{Name: "Blank", Filename: "Blank"},
+		{Name: "Lined", Filename: "P Lines medium"},
+		{Name: "Duplicate", Filename: "Blank"},
+	}
+
+	tests := []struct {
+		entries  []DeviceTemplate
+		filename string
+		want     int
+	}{
+		{entries, "Blank", 0},
+		{entries, "P Lines medium", 1},
+		{entries, "Missing", -1},
+		{entries, "blank", -1},
+		{nil, "Blank", -1},
+	}
+
+	for _, tt := range tests {
+		if got := indexOfTemplate(tt.entries, tt.filename); got != tt.want {
+			t.Errorf("indexOfTemplate(%q) = %d, want %d", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	blank := DeviceTemplate{Name: "Blank", Filename: "Blank", Categories: []string{"Creative"}}
+	grid := DeviceTemplate{Name: "Grid", Filename: "Grid", Categories: []string{"Grids"}}
+	renamedGrid := DeviceTemplate{Name: "Squares", Filename: "Grid", Categories: []string{"Grids"}}
+	dots := DeviceTemplate{Name: "Dots", Filename: "Dots", Categories: []string{"Grids"}}
+
+	tests := []struct {
+		name      string
+		base      []DeviceTemplate
+		current   []DeviceTemplate
+		templates []SyncTemplate
+		deletions []string
+		want      []string
+	}{
+		{
+			name:      "unrelated remote change",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{blank, grid, dots},
+			templates: []SyncTemplate{{Name: "Mine", Filename: "Mine"}},
+			deletions: []string{"Blank"},
+		},
+		{
+			name:      "upload of a template added remotely",
+			base:      []DeviceTemplate{blank},
+			current:   []DeviceTemplate{blank, dots},
+			templates: []SyncTemplate{{Name: "Dots", Filename: "Dots"}},
+			want:      []string{"Dots"},
+		},
+		{
+			name:      "upload of a template modified remotely",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{blank, renamedGrid},
+			templates: []SyncTemplate{{Name: "Grid", Filename: "Grid"}},
+			want:      []string{"Grid"},
+		},
+		{
+			name:      "upload of a template removed remotely",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{blank},
+			templates: []SyncTemplate{{Name: "Grid", Filename: "Grid"}},
+			want:      []string{"Grid"},
+		},
+		{
+			name:      "deletion of a template modified remotely",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{blank, renamedGrid},
+			deletions: []string{"Grid"},
+			want:      []string{"Grid"},
+		},
+		{
+			name:      "deletion of a template removed remotely",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{blank},
+			deletions: []string{"Grid"},
+		},
+		{
+			name:      "reordering alone is not a conflict",
+			base:      []DeviceTemplate{blank, grid},
+			current:   []DeviceTemplate{grid, blank},
+			templates: []SyncTemplate{{Name: "Blank", Filename: "Blank"}},
+			deletions: []string{"Grid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeConflicts(tt.base, tt.current, tt.templates, tt.deletions)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeConflicts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,225 +1,357 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"path"
+	"slices"
 	"strings"
 	"time"
 )
 
-// FetchTemplates reads the templates.json from the reMarkable device and returns the templates
-func (a *App) FetchTemplates() ([]DeviceTemplate, error) {
+// templatesDir is the directory holding the template images and templates.json on the device
+const templatesDir = "/usr/share/remarkable/templates"
+
+// templatesJSONPath is the path of templates.json on the device
+const templatesJSONPath = templatesDir + "/templates.json"
+
+// backupRootDir is the directory holding template backups on the device
+const backupRootDir = "/usr/share/remarkable/templates_backup"
+
+// FetchTemplates returns the templates on the reMarkable device along with a
+// revision token identifying the state of templates.json. On firmware that
+// supports them, the user templates are listed after the templates.json ones.
+func (a *App) FetchTemplates() (*TemplateList, error) {
 	if a.sshClient == nil {
 		return nil, fmt.Errorf("not connected to device")
 	}
 
-	// Create a new session
-	session, err := a.sshClient.NewSession()
+	content, data, err := a.readTemplatesJSON("FetchTemplates")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+		return nil, err
+	}
+
+	a.markStockTemplates("FetchTemplates", data.Templates)
+
+	list := &TemplateList{
+		Templates: data.Templates,
+		Revision:  a.rememberRevision(content),
 	}
-	defer session.Close()
 
-	// Read the templates.json file
-	output, err := session.Output("cat /usr/share/remarkable/templates/templates.json")
+	backend := a.templateBackend("FetchTemplates")
+	backendTemplates, err := backend.list("FetchTemplates")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read templates.json: %w", err)
+		return nil, err
 	}
+	list.Templates = append(list.Templates, backendTemplates...)
+	list.Format = backend.format()
+
+	return list, nil
+}
 
-	// Parse the JSON
+// maxFetchedRevisions is the number of templates.json revisions kept as merge bases
+const maxFetchedRevisions = 8
+
+// rememberRevision keeps templates.json content as a merge base and returns
+// its revision. Only the most recent maxFetchedRevisions are kept.
+func (a *App) rememberRevision(content []byte) string {
+	revision := templatesRevision(content)
+
+	a.fetchedRevisionsMu.Lock()
+	defer a.fetchedRevisionsMu.Unlock()
+	if a.fetchedRevisions == nil {
+		a.fetchedRevisions = make(map[string][]byte)
+	}
+	if _, ok := a.fetchedRevisions[revision]; ok {
+		// Move it to the end so it is dropped last
+		a.fetchedOrder = slices.DeleteFunc(a.fetchedOrder, func(r string) bool { return r == revision })
+	}
+	a.fetchedRevisions[revision] = content
+	a.fetchedOrder = append(a.fetchedOrder, revision)
+	for len(a.fetchedOrder) > maxFetchedRevisions {
+		delete(a.fetchedRevisions, a.fetchedOrder[0])
+		a.fetchedOrder = a.fetchedOrder[1:]
+	}
+
+	return revision
+}
+
+// templatesRevision returns the revision token for the given templates.json content
+func templatesRevision(content []byte) string {
+	return sha256Hex(content)
+}
+
+// sha256Hex returns the hex-encoded SHA-256 hash of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readTemplatesJSON reads and parses templates.json from the device, returning
+// both the raw file contents and the parsed data
+func (a *App) readTemplatesJSON(op string) ([]byte, templatesJSON, error) {
 	var data templatesJSON
+
+	output, err := a.runCommand(op, "cat "+shellQuote(templatesJSONPath))
+	if err != nil {
+		return nil, data, fmt.Errorf("failed to read templates.json: %w", err)
+	}
+
 	if err := json.Unmarshal(output, &data); err != nil {
-		return nil, fmt.Errorf("failed to parse templates.json: %w", err)
+		return nil, data, fmt.Errorf("failed to parse templates.json: %w", err)
 	}
 
-	return data.Templates, nil
+	return output, data, nil
 }
 
-// BackupTemplates creates a backup of the templates directory on the reMarkable device
-func (a *App) BackupTemplates() (string, error) {
-	log.Println("[Backup] Starting backup process...")
-
-	if a.sshClient == nil {
-		log.Println("[Backup] ERROR: Not connected to reMarkable device")
-		return "", fmt.Errorf("not connected to reMarkable device")
+// UnmarshalJSON keeps the top-level keys other than templates, so writing
+// the file back doesn't drop them
+func (t *templatesJSON) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
 	}
 
-	// Generate backup directory name: backup_YYYYMMDD_HHMMSS
-	timestamp := time.Now().Format("20060102_150405")
-	backupDir := fmt.Sprintf("/usr/share/remarkable/templates_backup/backup_%s", timestamp)
-	log.Printf("[Backup] Backup directory: %s", backupDir)
+	t.Templates = nil
+	if raw, ok := fields["templates"]; ok {
+		if err := json.Unmarshal(raw, &t.Templates); err != nil {
+			return err
+		}
+		delete(fields, "templates")
+	}
+	t.other = fields
+	return nil
+}
 
-	// Check if source directory exists
-	checkSession, err := a.sshClient.NewSession()
-	if err != nil {
-		log.Printf("[Backup] ERROR: Failed to create SSH session for check: %v", err)
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+// MarshalJSON writes the templates together with the kept top-level keys
+func (t templatesJSON) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any, len(t.other)+1)
+	for key, value := range t.other {
+		fields[key] = value
 	}
+	fields["templates"] = t.Templates
+	return json.Marshal(fields)
+}
 
-	output, err := checkSession.CombinedOutput("test -d /usr/share/remarkable/templates && echo 'exists' || echo 'missing'")
-	checkSession.Close()
+// marshalTemplatesJSON encodes templates.json the way the app writes it
+func marshalTemplatesJSON(data templatesJSON) (string, error) {
+	content, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		log.Printf("[Backup] WARNING: Failed to check source directory: %v", err)
-	} else {
-		log.Printf("[Backup] Source directory check: %s", strings.TrimSpace(string(output)))
+		return "", fmt.Errorf("failed to marshal templates.json: %w", err)
 	}
+	return string(content), nil
+}
 
-	// Create backup directory first
-	log.Println("[Backup] Creating backup directory...")
-	mkdirSession, err := a.sshClient.NewSession()
+// updatedTemplatesJSON returns the templates.json content to write for data
+// with its entries replaced. If that changes nothing but the formatting, the
+// current content is returned so the file isn't rewritten.
+func updatedTemplatesJSON(before []byte, data templatesJSON, entries []DeviceTemplate) (string, error) {
+	current, err := marshalTemplatesJSON(data)
 	if err != nil {
-		log.Printf("[Backup] ERROR: Failed to create SSH session for mkdir: %v", err)
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+		return "", err
 	}
-	mkdirCmd := "mkdir -p /usr/share/remarkable/templates_backup"
-	mkdirOutput, err := mkdirSession.CombinedOutput(mkdirCmd)
-	mkdirSession.Close()
+	data.Templates = entries
+	after, err := marshalTemplatesJSON(data)
 	if err != nil {
-		log.Printf("[Backup] ERROR: Failed to create backup directory: %v, output: %s", err, string(mkdirOutput))
-		return "", fmt.Errorf("failed to create backup directory: %w, output: %s", err, string(mkdirOutput))
+		return "", err
 	}
-	log.Printf("[Backup] Backup directory created, output: %s", string(mkdirOutput))
 
-	// Check if templates directory exists and get its size
-	checkSession2, err := a.sshClient.NewSession()
-	if err != nil {
-		log.Printf("[Backup] WARNING: Failed to create session for size check: %v", err)
-	} else {
-		sizeOutput, err := checkSession2.CombinedOutput("du -sh /usr/share/remarkable/templates 2>&1")
-		checkSession2.Close()
+	if after == current {
+		return string(before), nil
+	}
+	return after, nil
+}
+
+// templatesJSONDiff returns the unified diff between two templates.json
+// contents. Both are re-encoded first, so that differences in formatting,
+// such as escaped characters, don't show every line as changed.
+func templatesJSONDiff(before, after string) string {
+	normalize := func(content string) string {
+		var data templatesJSON
+		if err := json.Unmarshal([]byte(content), &data); err != nil {
+			return content
+		}
+		normalized, err := marshalTemplatesJSON(data)
 		if err != nil {
-			log.Printf("[Backup] WARNING: Failed to get templates size: %v, output: %s", err, string(sizeOutput))
-		} else {
-			log.Printf("[Backup] Templates directory size: %s", strings.TrimSpace(string(sizeOutput)))
+			return content
 		}
+		return normalized
 	}
 
-	// Copy templates
-	log.Println("[Backup] Copying templates...")
-	cpCmd := fmt.Sprintf("cp -r /usr/share/remarkable/templates %s", backupDir)
-	log.Printf("[Backup] Executing command: %s", cpCmd)
+	return unifiedDiff("a/templates.json", "b/templates.json", normalize(before), normalize(after))
+}
 
-	cpSession, err := a.sshClient.NewSession()
+// listTemplateFiles returns the set of file names in the templates directory on the device
+func (a *App) listTemplateFiles(op string) (map[string]bool, error) {
+	output, err := a.runCommand(op, "ls -1 "+shellQuote(templatesDir))
 	if err != nil {
-		log.Printf("[Backup] ERROR: Failed to create SSH session for copy: %v", err)
-		return "", fmt.Errorf("failed to create SSH session for copy: %w", err)
+		return nil, fmt.Errorf("failed to list templates directory: %w", err)
 	}
-	cpOutput, err := cpSession.CombinedOutput(cpCmd)
-	cpSession.Close()
-	if err != nil {
-		log.Printf("[Backup] ERROR: Failed to copy templates: %v, output: %s", err, string(cpOutput))
-		return "", fmt.Errorf("failed to backup templates: %w, output: %s", err, string(cpOutput))
+
+	files := make(map[string]bool)
+	for _, name := range strings.Split(string(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			files[name] = true
+		}
 	}
-	log.Printf("[Backup] Copy command output: %s", string(cpOutput))
 
-	// Verify backup was created
-	verifySession, err := a.sshClient.NewSession()
+	return files, nil
+}
+
+// BackupTemplates creates a backup of the templates directory on the
+// reMarkable device and then applies the backup retention policy
+func (a *App) BackupTemplates() (string, error) {
+	var backupDir string
+	err := a.withWritableRoot("Backup", func() error {
+		var err error
+		backupDir, err = a.backupTemplates()
+		return err
+	})
 	if err != nil {
-		log.Printf("[Backup] WARNING: Failed to create session for verification: %v", err)
-	} else {
-		verifyOutput, err := verifySession.CombinedOutput(fmt.Sprintf("test -d %s && echo 'backup exists' || echo 'backup missing'", backupDir))
-		verifySession.Close()
-		if err != nil {
-			log.Printf("[Backup] WARNING: Failed to verify backup: %v, output: %s", err, string(verifyOutput))
-		} else {
-			log.Printf("[Backup] Backup verification: %s", strings.TrimSpace(string(verifyOutput)))
-		}
+		return "", err
 	}
 
-	log.Printf("[Backup] SUCCESS: Backup completed at %s", backupDir)
+	a.applyBackupRetention()
 	return backupDir, nil
 }
 
-// SyncTemplates uploads new templates to the device and updates templates.json
-func (a *App) SyncTemplates(templates []SyncTemplate, deletions []string) error {
+// applyBackupRetention prunes old backups, only logging failures
+func (a *App) applyBackupRetention() {
+	if pruned, err := a.PruneBackups(); err != nil {
+		log.Printf("[Backup] WARNING: Failed to prune old backups: %v", err)
+	} else if len(pruned) > 0 {
+		log.Printf("[Backup] Pruned %d old backup(s)", len(pruned))
+	}
+}
+
+// backupTemplates copies the templates directory to a new backup folder,
+// writes its manifest and verifies the copy. It does not prune old backups.
+func (a *App) backupTemplates() (string, error) {
+	log.Println("[Backup] Starting backup process...")
+
 	if a.sshClient == nil {
-		return fmt.Errorf("not connected to reMarkable device")
+		log.Println("[Backup] ERROR: Not connected to reMarkable device")
+		return "", fmt.Errorf("not connected to reMarkable device")
 	}
 
-	if len(templates) == 0 && len(deletions) == 0 {
-		return nil
+	// Generate backup directory name: backup_YYYYMMDD_HHMMSS
+	timestamp := time.Now().Format("20060102_150405")
+	backupDir := fmt.Sprintf("%s/backup_%s", backupRootDir, timestamp)
+	log.Printf("[Backup] Backup directory: %s", backupDir)
+
+	// Check if source directory exists
+	output, err := a.runCommand("Backup", "test -d /usr/share/remarkable/templates && echo 'exists' || echo 'missing'")
+	if err != nil {
+		log.Printf("[Backup] WARNING: Failed to check source directory: %v", err)
+	} else {
+		log.Printf("[Backup] Source directory check: %s", strings.TrimSpace(string(output)))
 	}
 
-	// Step 1: Upload each template file via SCP
-	for _, tmpl := range templates {
-		if err := a.scpUploadFile(tmpl.LocalPath, "/usr/share/remarkable/templates/"); err != nil {
-			return fmt.Errorf("failed to upload %s: %w", tmpl.Filename, err)
-		}
+	// Make sure the backup fits on the device
+	if err := a.checkBackupSpace(); err != nil {
+		log.Printf("[Backup] ERROR: %v", err)
+		return "", err
 	}
 
-	// Step 2: Read current templates.json from device
-	session, err := a.sshClient.NewSession()
+	// Hash the source before copying, so the copy can be checked against it
+	log.Println("[Backup] Hashing templates...")
+	files, err := a.remoteFileDigests("Backup", templatesDir)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
+		log.Printf("[Backup] ERROR: Failed to hash templates: %v", err)
+		return "", fmt.Errorf("failed to backup templates: %w", err)
 	}
 
-	output, err := session.Output("cat /usr/share/remarkable/templates/templates.json")
-	session.Close()
-	if err != nil {
-		return fmt.Errorf("failed to read templates.json: %w", err)
+	// Create backup directory first
+	log.Println("[Backup] Creating backup directory...")
+	if _, err := a.runCommand("Backup", "mkdir -p "+backupRootDir); err != nil {
+		log.Printf("[Backup] ERROR: Failed to create backup directory: %v", err)
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	var data templatesJSON
-	if err := json.Unmarshal(output, &data); err != nil {
-		return fmt.Errorf("failed to parse templates.json: %w", err)
+	// Copy templates
+	log.Println("[Backup] Copying templates...")
+	cpCmd := fmt.Sprintf("cp -r /usr/share/remarkable/templates %s", backupDir)
+	log.Printf("[Backup] Executing command: %s", cpCmd)
+	if _, err := a.runCommand("Backup", cpCmd); err != nil {
+		log.Printf("[Backup] ERROR: Failed to copy templates: %v", err)
+		return "", fmt.Errorf("failed to backup templates: %w", err)
 	}
 
-	// Step 3: Remove deleted template entries
-	if len(deletions) > 0 {
-		deletionSet := make(map[string]bool)
-		for _, filename := range deletions {
-			deletionSet[filename] = true
-		}
-		var filteredTemplates []DeviceTemplate
-		for _, tmpl := range data.Templates {
-			if !deletionSet[tmpl.Filename] {
-				filteredTemplates = append(filteredTemplates, tmpl)
-			}
-		}
-		data.Templates = filteredTemplates
+	// Store the source's sizes and hashes as the manifest, then verify the copy against it
+	log.Println("[Backup] Writing manifest...")
+	if err := a.writeDeviceBackupManifest(backupDir, files); err != nil {
+		log.Printf("[Backup] ERROR: Failed to write manifest: %v", err)
+		a.runCommand("Backup", "rm -rf "+shellQuote(backupDir))
+		return "", fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	verification, err := a.VerifyBackup(BackupOnDevice + ":" + path.Base(backupDir))
+	if err != nil {
+		log.Printf("[Backup] ERROR: Backup verification failed: %v", err)
+		a.runCommand("Backup", "rm -rf "+shellQuote(backupDir))
+		return "", fmt.Errorf("backup verification failed: %w", err)
 	}
+	if !verification.OK {
+		log.Printf("[Backup] ERROR: Backup verification failed: %d missing, %d corrupted, %d unexpected file(s)",
+			len(verification.Missing), len(verification.Corrupted), len(verification.Unexpected))
+		a.runCommand("Backup", "rm -rf "+shellQuote(backupDir))
+		return "", fmt.Errorf("backup verification failed, the copy on the device is incomplete")
+	}
+	log.Printf("[Backup] Backup verification: %d files verified", verification.Verified)
 
-	// Step 4: Add new template entries
-	for _, tmpl := range templates {
-		newEntry := DeviceTemplate{
-			Name:       tmpl.Name,
-			Filename:   tmpl.Filename,
-			IconCode:   "\ue9fe",
-			Categories: []string{"Creative", "Lines", "Grids", "Planners"},
-		}
-		data.Templates = append(data.Templates, newEntry)
+	log.Printf("[Backup] SUCCESS: Backup completed at %s", backupDir)
+	return backupDir, nil
+}
+
+// SyncTemplates uploads new templates to the device, deletes removed ones
+// and updates templates.json. .template files are added as user templates on
+// firmware that supports them. If templates.json changed since
+// options.Revision was fetched, the sync is refused, or merged when
+// options.Merge is set and the changes don't conflict. Built-in templates are
+// only changed when options.AllowStockChanges is set. The changes are applied
+// as a transaction, see ApplySyncPlan. With options.RestartUI the interface
+// is restarted afterwards.
+func (a *App) SyncTemplates(templates []SyncTemplate, deletions []string, options SyncOptions) (*SyncResult, error) {
+	if a.sshClient == nil {
+		return nil, fmt.Errorf("not connected to reMarkable device")
 	}
 
-	// Step 5: Write updated templates.json back to device
-	updatedJSON, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal templates.json: %w", err)
+	result, err := a.syncTemplates(templates, deletions, options)
+	if err != nil || !options.RestartUI {
+		return result, err
 	}
 
-	// Write via SSH using stdin redirection
-	writeSession, err := a.sshClient.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed to create SSH session for write: %w", err)
+	// The sync itself succeeded, so a failed restart is only reported
+	if err := a.RestartUI(); err != nil {
+		log.Printf("[Sync] WARNING: %v", err)
+		result.RestartError = err.Error()
 	}
-	defer writeSession.Close()
 
-	// Get stdin pipe for writing
-	stdin, err := writeSession.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdin pipe: %w", err)
+	return result, nil
+}
+
+// syncTemplates plans the sync, checks it against options.Revision and applies it
+func (a *App) syncTemplates(templates []SyncTemplate, deletions []string, options SyncOptions) (*SyncResult, error) {
+	if len(templates) == 0 && len(deletions) == 0 && len(options.Order) == 0 {
+		return &SyncResult{Status: SyncCommitted, Revision: options.Revision}, nil
 	}
 
-	// Start writing in a goroutine
-	go func() {
-		defer stdin.Close()
-		stdin.Write(updatedJSON)
-	}()
+	plan, err := a.PlanSync(templates, deletions, options)
+	if err != nil {
+		return nil, err
+	}
 
-	// Run cat command to write to file
-	if err := writeSession.Run("cat > /usr/share/remarkable/templates/templates.json"); err != nil {
-		return fmt.Errorf("failed to write templates.json: %w", err)
+	if options.Revision != "" && options.Revision != plan.Revision {
+		if !options.Merge {
+			return nil, fmt.Errorf("templates.json was changed on the device since the templates were loaded, reload them and try again")
+		}
+		if err := a.checkMergeConflicts(options.Revision, plan, templates, deletions); err != nil {
+			return nil, err
+		}
+		log.Printf("[Sync] Merging changes made against revision %s onto %s", options.Revision, plan.Revision)
 	}
 
-	return nil
+	return a.ApplySyncPlan(plan, options)
 }
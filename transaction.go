@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// remoteTransaction records the original state of the device files an
+// operation touches, so the operation can be undone if a later step fails
+type remoteTransaction struct {
+	app       *App
+	op        string
+	paths     []string
+	originals map[string][]byte
+	created   map[string]bool
+}
+
+// beginTransaction starts recording changes made on behalf of op
+func (a *App) beginTransaction(op string) *remoteTransaction {
+	return &remoteTransaction{
+		app:       a,
+		op:        op,
+		originals: make(map[string][]byte),
+		created:   make(map[string]bool),
+	}
+}
+
+// snapshot saves the current content of remotePath before it is written or
+// deleted. Paths that do not exist yet are remembered so rollback can remove them.
+func (t *remoteTransaction) snapshot(remotePath string) error {
+	if _, ok := t.originals[remotePath]; ok || t.created[remotePath] {
+		return nil
+	}
+
+	// The first byte tells whether the file existed, the rest is its content
+	quoted := shellQuote(remotePath)
+	output, err := t.app.runCommand(t.op, fmt.Sprintf("if [ -f %s ]; then printf 1; cat %s; else printf 0; fi", quoted, quoted))
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", remotePath, err)
+	}
+	if len(output) == 0 {
+		return fmt.Errorf("failed to snapshot %s: empty output", remotePath)
+	}
+
+	t.paths = append(t.paths, remotePath)
+	if output[0] == '1' {
+		t.originals[remotePath] = output[1:]
+	} else {
+		t.created[remotePath] = true
+	}
+
+	return nil
+}
+
+// rollback restores every snapshotted file and removes files that did not
+// exist when the transaction started
+func (t *remoteTransaction) rollback() error {
+	log.Printf("[%s] Rolling back %d file(s)...", t.op, len(t.paths))
+
+	var errs []error
+	var created []string
+	for _, remotePath := range t.paths {
+		if t.created[remotePath] {
+			created = append(created, shellQuote(remotePath))
+			continue
+		}
+		if err := t.app.runCommandWithInput(t.op, "cat > "+shellQuote(remotePath), t.originals[remotePath]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", remotePath, err))
+		}
+	}
+
+	if len(created) > 0 {
+		if _, err := t.app.runCommand(t.op, "rm -f "+strings.Join(created, " ")); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove new files: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// finish turns the outcome of a transaction into a SyncResult, rolling back
+// if err is non-nil. The returned error describes both the failure and the rollback.
+func (t *remoteTransaction) finish(plan *SyncPlan, err error) (*SyncResult, error) {
+	if err == nil {
+		log.Printf("[%s] Transaction committed", t.op)
+		result := &SyncResult{Status: SyncCommitted, Plan: plan}
+		if plan != nil {
+			// The written content is the base for merging the next sync
+			result.Revision = t.app.rememberRevision([]byte(plan.After))
+		}
+		return result, nil
+	}
+
+	result := &SyncResult{Status: SyncRolledBack, Error: err.Error(), Plan: plan}
+	if rollbackErr := t.rollback(); rollbackErr != nil {
+		log.Printf("[%s] ERROR: Rollback failed: %v", t.op, rollbackErr)
+		result.Status = SyncRollbackFailed
+		result.RollbackError = rollbackErr.Error()
+		return result, fmt.Errorf("%w; rollback failed, the device may be in a partial state: %v", err, rollbackErr)
+	}
+
+	log.Printf("[%s] Transaction rolled back: %v", t.op, err)
+	return result, fmt.Errorf("%w; all changes were rolled back", err)
+}
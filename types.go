@@ -1,11 +1,28 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // SSHKey represents an SSH key found on the system
 type SSHKey struct {
 	Name string `json:"name"`
 	Path string `json:"path"`
 }
 
+// AuthorizedKey is a public key listed in the device's authorized_keys
+type AuthorizedKey struct {
+	Type string `json:"type"`
+	// Fingerprint is the SHA256 fingerprint, as printed by ssh-keygen -l
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment"`
+	// Options are the comma-separated options before the key, if any
+	Options string `json:"options"`
+	// InUse is set for the key of the current connection
+	InUse bool `json:"inUse"`
+}
+
 // DeviceTemplate represents a template on the reMarkable device
 type DeviceTemplate struct {
 	Name       string   `json:"name"`
@@ -13,11 +30,25 @@ type DeviceTemplate struct {
 	IconCode   string   `json:"iconCode"`
 	Landscape  bool     `json:"landscape,omitempty"`
 	Categories []string `json:"categories"`
+	// Stock marks reMarkable's built-in templates. It is never written to templates.json.
+	Stock bool `json:"stock,omitempty"`
+}
+
+// TemplateList is the list of templates on the device together with the
+// revision of templates.json it was read from
+type TemplateList struct {
+	Templates []DeviceTemplate `json:"templates"`
+	Revision  string           `json:"revision"`
+	// Format is TemplateFormatUser when the device also lists user templates,
+	// otherwise TemplateFormatLegacy
+	Format string `json:"format"`
 }
 
 // templatesJSON is the structure of the templates.json file on the device
 type templatesJSON struct {
 	Templates []DeviceTemplate `json:"templates"`
+	// other holds the top-level keys the app doesn't use, written back unchanged
+	other map[string]json.RawMessage
 }
 
 // SelectedFile contains information about a selected file
@@ -32,3 +63,303 @@ type SyncTemplate struct {
 	Filename  string `json:"filename"`
 	LocalPath string `json:"localPath"`
 }
+
+// SyncOptions controls how SyncTemplates applies changes
+type SyncOptions struct {
+	// Revision is the templates.json revision the changes were made against,
+	// as returned by FetchTemplates. Empty skips the concurrency check.
+	Revision string `json:"revision"`
+	// Merge applies the changes on top of a newer templates.json instead of
+	// refusing, as long as they do not conflict with the changes made since Revision
+	Merge bool `json:"merge"`
+	// AllowStockChanges allows deleting, modifying or overwriting built-in templates
+	AllowStockChanges bool `json:"allowStockChanges"`
+	// Order lists template filenames in the order they should appear in
+	// templates.json. Templates not listed keep their relative order after them.
+	Order []string `json:"order"`
+	// Snapshot saves templates.json and the files the sync overwrites or
+	// deletes to the local sync history before changing anything, see UndoSync
+	Snapshot bool `json:"snapshot"`
+	// RestartUI restarts the reMarkable interface after a committed sync so
+	// the changes show without a reboot, see RestartUI
+	RestartUI bool `json:"restartUI"`
+}
+
+// SyncPlan describes the changes a sync will make, computed without touching the device
+type SyncPlan struct {
+	Revision  string           `json:"revision"`
+	Uploads   []PlannedUpload  `json:"uploads"`
+	Deletions []string         `json:"deletions"`
+	Added     []DeviceTemplate `json:"added"`
+	Removed   []DeviceTemplate `json:"removed"`
+	Changed   []TemplateChange `json:"changed"`
+	Reordered bool             `json:"reordered"`
+	// KeptFiles are the image files of removed templates, which stay on the
+	// device as only their templates.json entries are removed
+	KeptFiles []string `json:"keptFiles"`
+	// UserTemplates are the .template files added to the xochitl folder, on
+	// firmware that supports user templates
+	UserTemplates []PlannedUserTemplate `json:"userTemplates"`
+	// UserDeletions are the IDs of the user templates to delete
+	UserDeletions []string `json:"userDeletions"`
+	// StockChanges lists the built-in templates the plan touches, which
+	// requires SyncOptions.AllowStockChanges
+	StockChanges []string `json:"stockChanges"`
+	Before       string   `json:"before"`
+	After        string   `json:"after"`
+	Diff         string   `json:"diff"`
+}
+
+// PlannedUpload is a template file that a sync will upload to the device
+type PlannedUpload struct {
+	Filename   string `json:"filename"`
+	LocalPath  string `json:"localPath"`
+	RemotePath string `json:"remotePath"`
+	Size       int64  `json:"size"`
+	// SHA256 is the hash of the local file when the plan was made
+	SHA256    string `json:"sha256"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// PlannedUserTemplate is a .template file that a sync will add as a user template
+type PlannedUserTemplate struct {
+	// ID is the UUID the template is stored under, its filename once listed
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	LocalPath string `json:"localPath"`
+	Size      int64  `json:"size"`
+	// SHA256 is the hash of the local file when the plan was made
+	SHA256 string `json:"sha256"`
+}
+
+// TemplateChange is a templates.json entry that a sync will modify
+type TemplateChange struct {
+	Before DeviceTemplate `json:"before"`
+	After  DeviceTemplate `json:"after"`
+}
+
+// Sync transaction outcomes reported in SyncResult.Status
+const (
+	SyncCommitted      = "committed"
+	SyncRolledBack     = "rolled_back"
+	SyncRollbackFailed = "rollback_failed"
+)
+
+// SyncResult reports whether a sync transaction was committed or rolled back
+type SyncResult struct {
+	Status        string `json:"status"`
+	Revision      string `json:"revision"`
+	Error         string `json:"error,omitempty"`
+	RollbackError string `json:"rollbackError,omitempty"`
+	// Backup is the device folder holding files backed up before the change, if any
+	Backup string `json:"backup,omitempty"`
+	// Snapshot is the ID of the pre-sync snapshot in the sync history, if one was taken
+	Snapshot string    `json:"snapshot,omitempty"`
+	Plan     *SyncPlan `json:"plan,omitempty"`
+	// RestartError is set when the sync was committed but the interface
+	// could not be restarted as requested
+	RestartError string `json:"restartError,omitempty"`
+}
+
+// BackupMetadata describes the device a backup was taken from
+type BackupMetadata struct {
+	Serial     string    `json:"serial"`
+	Firmware   string    `json:"firmware"`
+	CreatedAt  time.Time `json:"createdAt"`
+	AppVersion string    `json:"appVersion"`
+}
+
+// LocalBackup is a backup archive downloaded to the local computer
+type LocalBackup struct {
+	Path     string         `json:"path"`
+	Size     int64          `json:"size"`
+	Files    int            `json:"files"`
+	Metadata BackupMetadata `json:"metadata"`
+}
+
+// BackupInfo describes a backup on the device or in the local backup folder
+type BackupInfo struct {
+	ID        string    `json:"id"`
+	Location  string    `json:"location"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+	Templates int       `json:"templates"`
+	// Metadata is only known for local backups
+	Metadata *BackupMetadata `json:"metadata,omitempty"`
+}
+
+// BackupRetention is the policy for pruning backups on the device. A backup
+// is kept if any rule keeps it; with both rules at zero every backup is kept.
+type BackupRetention struct {
+	// KeepLast keeps the most recent backups
+	KeepLast int `json:"keepLast"`
+	// KeepMonthly keeps the oldest backup of each of the most recent months
+	KeepMonthly int `json:"keepMonthly"`
+}
+
+// SyncSnapshot is an entry of the local sync history: the device files as
+// they were before a sync, which UndoSync restores
+type SyncSnapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Serial    string    `json:"serial"`
+	// Revision is the templates.json revision the sync produced
+	Revision string `json:"revision"`
+	Summary  string `json:"summary"`
+	// Files are the device files restored by an undo
+	Files []string `json:"files"`
+	// Created are the device files the sync added, removed by an undo
+	Created []string `json:"created"`
+}
+
+// BackupManifest lists every file of a backup with its size and SHA-256 hash
+type BackupManifest struct {
+	CreatedAt time.Time      `json:"createdAt"`
+	Firmware  string         `json:"firmware"`
+	Serial    string         `json:"serial"`
+	Files     []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file listed in a backup manifest
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupVerification is the result of checking a backup against its manifest
+type BackupVerification struct {
+	ID       string `json:"id"`
+	OK       bool   `json:"ok"`
+	Verified int    `json:"verified"`
+	// Missing files are listed in the manifest but absent from the backup
+	Missing []string `json:"missing"`
+	// Corrupted files differ in size or hash from the manifest
+	Corrupted []string `json:"corrupted"`
+	// Unexpected files are in the backup but not listed in the manifest
+	Unexpected []string `json:"unexpected"`
+}
+
+// InstalledTemplate is a custom template the app installed on a device
+type InstalledTemplate struct {
+	Entry DeviceTemplate `json:"entry"`
+	// Files are the template's image file names in the templates directory,
+	// or the .template file of a user template
+	Files []string `json:"files"`
+}
+
+// InstalledTemplatesStatus tells whether the custom templates installed on
+// the connected device are still there
+type InstalledTemplatesStatus struct {
+	Firmware         string `json:"firmware"`
+	RecordedFirmware string `json:"recordedFirmware"`
+	// FirmwareChanged is set when the device was updated since the last sync
+	FirmwareChanged bool `json:"firmwareChanged"`
+	Installed       int  `json:"installed"`
+	// Missing lists the filenames of the templates that can be reinstalled
+	Missing []string `json:"missing"`
+}
+
+// PersistenceStatus describes the on-device hook that restores custom
+// templates from /home/root at boot
+type PersistenceStatus struct {
+	OK              bool `json:"ok"`
+	ScriptInstalled bool `json:"scriptInstalled"`
+	// ScriptCurrent is set when the script matches this version of the app
+	ScriptCurrent bool `json:"scriptCurrent"`
+	UnitInstalled bool `json:"unitInstalled"`
+	UnitCurrent   bool `json:"unitCurrent"`
+	Enabled       bool `json:"enabled"`
+	// Templates is the number of templates.json entries in the store
+	Templates int `json:"templates"`
+}
+
+// DeviceInfo describes the connected reMarkable
+type DeviceInfo struct {
+	Model string `json:"model"`
+	// Machine is the SoC machine name the model was derived from
+	Machine string `json:"machine"`
+	// Firmware is the build from /etc/version
+	Firmware string `json:"firmware"`
+	// XochitlVersion is the release version of the UI, such as 3.8.2.1965
+	XochitlVersion string `json:"xochitlVersion"`
+	Serial         string `json:"serial"`
+	ScreenWidth    int    `json:"screenWidth"`
+	ScreenHeight   int    `json:"screenHeight"`
+}
+
+// RebootProgress is emitted while RebootDevice waits for the device
+type RebootProgress struct {
+	// Stage is one of RebootStarted, RebootWaiting, RebootReconnecting, RebootOnline or RebootFailed
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+}
+
+// DiskUsage is the size and usage of a filesystem in bytes
+type DiskUsage struct {
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+	Free  int64 `json:"free"`
+}
+
+// DeviceStatus is a snapshot of the connected device's state
+type DeviceStatus struct {
+	// BatteryLevel is the charge in percent, or -1 if unknown
+	BatteryLevel int `json:"batteryLevel"`
+	// BatteryStatus is the kernel's battery status, such as Charging or Discharging
+	BatteryStatus string    `json:"batteryStatus"`
+	Charging      bool      `json:"charging"`
+	Root          DiskUsage `json:"root"`
+	Home          DiskUsage `json:"home"`
+	// Uptime is the time since boot in seconds
+	Uptime int64 `json:"uptime"`
+	// Connection is ConnectionUSB or ConnectionWiFi
+	Connection string `json:"connection"`
+	// MountMode is "ro" or "rw" for the root filesystem
+	MountMode string `json:"mountMode"`
+}
+
+// Screenshot is a capture of the device's screen
+type Screenshot struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// PNG is the encoded image, base64 encoded in JSON
+	PNG []byte `json:"png"`
+}
+
+// SplashScreen is one of the screens shown while the device sleeps, powers off or starts
+type SplashScreen struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Customized is set when the original is backed up and can be restored
+	Customized bool `json:"customized"`
+	// Image is the PNG, base64 encoded in JSON, for previews
+	Image []byte `json:"image"`
+}
+
+// OperationLogEntry is one remote command run on the device
+type OperationLogEntry struct {
+	Time time.Time `json:"time"`
+	// Operation is the app operation that ran the command, such as Sync or Backup
+	Operation string `json:"operation"`
+	Command   string `json:"command"`
+	// ExitCode is the command's exit status, or -1 if it did not exit normally
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	BytesSent  int64  `json:"bytesSent"`
+	BytesRecv  int64  `json:"bytesRecv"`
+	Error      string `json:"error,omitempty"`
+}
+
+// OperationLogQuery filters the operation log, zero values match everything
+type OperationLogQuery struct {
+	Operation  string `json:"operation"`
+	FailedOnly bool   `json:"failedOnly"`
+	// Search matches a substring of the command
+	Search string `json:"search"`
+	// Limit caps the number of entries returned, newest first
+	Limit int `json:"limit"`
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xochitlDir holds the documents of the device, including user templates
+const xochitlDir = "/home/root/.local/share/remarkable/xochitl"
+
+// userTemplateType is the metadata type of user templates
+const userTemplateType = "TemplateType"
+
+// userTemplateID matches the UUIDs user templates are stored under
+var userTemplateID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// userTemplateMetadata is the .metadata file stored next to each user template
+type userTemplateMetadata struct {
+	CreatedTime      string `json:"createdTime"`
+	LastModified     string `json:"lastModified"`
+	Parent           string `json:"parent"`
+	Pinned           bool   `json:"pinned"`
+	Type             string `json:"type"`
+	VisibleName      string `json:"visibleName"`
+	Deleted          bool   `json:"deleted"`
+	MetadataModified bool   `json:"metadatamodified"`
+	Modified         bool   `json:"modified"`
+	Synced           bool   `json:"synced"`
+	Version          int    `json:"version"`
+}
+
+// userTemplateFile holds the fields of a .template file the app reads
+type userTemplateFile struct {
+	Name       string   `json:"name"`
+	Categories []string `json:"categories"`
+}
+
+// userTemplateExt is the extension of user template files
+const userTemplateExt = ".template"
+
+// userTemplateFileExts are the files the device keeps for each user template,
+// stored as <uuid>.template with a <uuid>.metadata file and possibly a
+// <uuid>.content file. The filename of its entry is the UUID.
+var userTemplateFileExts = []string{userTemplateExt, ".metadata", ".content"}
+
+// userTemplateBackend adds user templates, stored as .template files in the
+// xochitl folder, to the templates listed in templates.json
+type userTemplateBackend struct {
+	app *App
+}
+
+func (b *userTemplateBackend) format() string { return TemplateFormatUser }
+
+// list reads the metadata and template file of every user template
+func (b *userTemplateBackend) list(op string) ([]DeviceTemplate, error) {
+	// Print three lines per template: its ID, its metadata and its template
+	// file. JSON strings cannot contain newlines, so removing them is safe.
+	cmd := fmt.Sprintf(`cd %s 2>/dev/null || exit 0; for f in *.metadata; do grep -q '"%s"' "$f" 2>/dev/null || continue; id=${f%%.metadata}; echo "$id"; tr -d '\n' < "$f"; echo; tr -d '\n' < "$id.template" 2>/dev/null; echo; done`,
+		shellQuote(xochitlDir), userTemplateType)
+	output, err := b.app.runCommand(op, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user templates: %w", err)
+	}
+
+	templates := []DeviceTemplate{}
+	lines := strings.Split(string(output), "\n")
+	for i := 0; i+2 < len(lines); i += 3 {
+		id := strings.TrimSpace(lines[i])
+
+		var metadata userTemplateMetadata
+		if err := json.Unmarshal([]byte(lines[i+1]), &metadata); err != nil {
+			log.Printf("[%s] WARNING: Skipping user template %s with invalid metadata: %v", op, id, err)
+			continue
+		}
+		if metadata.Type != userTemplateType || metadata.Deleted {
+			continue
+		}
+
+		// A template file that can't be parsed still lists the template
+		var file userTemplateFile
+		json.Unmarshal([]byte(lines[i+2]), &file)
+
+		categories := file.Categories
+		if categories == nil {
+			categories = []string{}
+		}
+		templates = append(templates, DeviceTemplate{
+			Name:       metadata.VisibleName,
+			Filename:   id,
+			IconCode:   "",
+			Categories: categories,
+		})
+	}
+
+	return templates, nil
+}
+
+// isUserTemplateFile reports whether a local file is a user template
+func isUserTemplateFile(localPath string) bool {
+	return strings.ToLower(filepath.Ext(localPath)) == userTemplateExt
+}
+
+// planUserTemplate checks a local .template file and assigns it the ID it
+// will be stored under
+func planUserTemplate(tmpl SyncTemplate) (PlannedUserTemplate, DeviceTemplate, error) {
+	content, err := os.ReadFile(tmpl.LocalPath)
+	if err != nil {
+		return PlannedUserTemplate{}, DeviceTemplate{}, fmt.Errorf("failed to read %s: %w", tmpl.Filename, err)
+	}
+	var file userTemplateFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return PlannedUserTemplate{}, DeviceTemplate{}, fmt.Errorf("%s is not a valid template file: %w", tmpl.LocalPath, err)
+	}
+	id, err := newUUID()
+	if err != nil {
+		return PlannedUserTemplate{}, DeviceTemplate{}, err
+	}
+
+	categories := file.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	planned := PlannedUserTemplate{
+		ID:        id,
+		Name:      tmpl.Name,
+		LocalPath: tmpl.LocalPath,
+		Size:      int64(len(content)),
+		SHA256:    sha256Hex(content),
+	}
+	return planned, DeviceTemplate{Name: tmpl.Name, Filename: id, Categories: categories}, nil
+}
+
+// plan adds the .template files and the deletions of user templates to the
+// plan, returning the templates and deletions left for templates.json
+func (b *userTemplateBackend) plan(plan *SyncPlan, templates []SyncTemplate, deletions []string) ([]SyncTemplate, []string, error) {
+	userTemplates, err := b.list("PlanSync")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var legacyTemplates []SyncTemplate
+	for _, tmpl := range templates {
+		if !isUserTemplateFile(tmpl.LocalPath) {
+			legacyTemplates = append(legacyTemplates, tmpl)
+			continue
+		}
+		planned, entry, err := planUserTemplate(tmpl)
+		if err != nil {
+			return nil, nil, err
+		}
+		plan.UserTemplates = append(plan.UserTemplates, planned)
+		plan.Added = append(plan.Added, entry)
+	}
+
+	var legacyDeletions []string
+	for _, filename := range deletions {
+		i := -1
+		if userTemplateID.MatchString(filename) {
+			i = indexOfTemplate(userTemplates, filename)
+		}
+		if i < 0 {
+			legacyDeletions = append(legacyDeletions, filename)
+			continue
+		}
+		plan.UserDeletions = append(plan.UserDeletions, filename)
+		plan.Removed = append(plan.Removed, userTemplates[i])
+	}
+
+	return legacyTemplates, legacyDeletions, nil
+}
+
+// userTemplatePaths returns the device files of the user template with the given ID
+func userTemplatePaths(id string) []string {
+	paths := make([]string, len(userTemplateFileExts))
+	for i, ext := range userTemplateFileExts {
+		paths[i] = path.Join(xochitlDir, id+ext)
+	}
+	return paths
+}
+
+// apply writes the user templates of a plan and removes the deleted ones
+func (b *userTemplateBackend) apply(plan *SyncPlan) error {
+	if len(plan.UserTemplates) > 0 {
+		if _, err := b.app.runCommand("ApplySyncPlan", "mkdir -p "+shellQuote(xochitlDir)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", xochitlDir, err)
+		}
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for _, tmpl := range plan.UserTemplates {
+		content, err := os.ReadFile(tmpl.LocalPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", tmpl.Name, err)
+		}
+		metadata, err := json.MarshalIndent(userTemplateMetadata{
+			CreatedTime:  now,
+			LastModified: now,
+			Type:         userTemplateType,
+			VisibleName:  tmpl.Name,
+		}, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+
+		base := path.Join(xochitlDir, tmpl.ID)
+		if err := b.app.runCommandWithInput("ApplySyncPlan", "cat > "+shellQuote(base+userTemplateExt), content); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", tmpl.Name, err)
+		}
+		if err := b.app.runCommandWithInput("ApplySyncPlan", "cat > "+shellQuote(base+".metadata"), metadata); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", tmpl.Name, err)
+		}
+	}
+
+	if len(plan.UserDeletions) > 0 {
+		var quoted []string
+		for _, id := range plan.UserDeletions {
+			for _, remotePath := range userTemplatePaths(id) {
+				quoted = append(quoted, shellQuote(remotePath))
+			}
+		}
+		if _, err := b.app.runCommand("ApplySyncPlan", "rm -f "+strings.Join(quoted, " ")); err != nil {
+			return fmt.Errorf("failed to delete user templates: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// verify checks that the device lists the added user templates and no
+// longer lists the deleted ones
+func (b *userTemplateBackend) verify(plan *SyncPlan) error {
+	if len(plan.UserTemplates) == 0 && len(plan.UserDeletions) == 0 {
+		return nil
+	}
+
+	listed, err := b.list("ApplySyncPlan")
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	for _, tmpl := range plan.UserTemplates {
+		if indexOfTemplate(listed, tmpl.ID) < 0 {
+			return fmt.Errorf("verification failed: %s is not listed on the device", tmpl.Name)
+		}
+	}
+	for _, id := range plan.UserDeletions {
+		if indexOfTemplate(listed, id) >= 0 {
+			return fmt.Errorf("verification failed: %s was not deleted", id)
+		}
+	}
+
+	return nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate template ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}